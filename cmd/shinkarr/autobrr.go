@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+	"github.com/varoOP/shinkarr/internal/anime"
+	"github.com/varoOP/shinkarr/internal/autobrr"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/season"
+	"github.com/varoOP/shinkarr/internal/state"
+)
+
+// updateAutobrrFilter adds the titles of a to the shows of the filter so
+// autobrr grabs their releases as soon as they come out. A failure is
+// reported but doesn't undo the rest of the run.
+func updateAutobrrFilter(c *autobrr.Client, filterID int32, a []anime.Anime) {
+	titles := []string{}
+	for _, v := range a {
+		titles = append(titles, v.Titles()...)
+	}
+
+	n, err := c.AddShows(filterID, titles)
+	if err != nil {
+		fmt.Printf("\nautobrr filter %v not updated:\n%v\n", filterID, err)
+		return
+	}
+
+	fmt.Printf("\nTitles added to autobrr filter %v: %v\n", filterID, n)
+}
+
+// updateSeasonFilter adds the titles of a to the autobrr filter of the
+// season, creating it from the template filter the first time. No filter is
+// created for a season that is already over.
+func updateSeasonFilter(c *autobrr.Client, st *state.DB, ab *config.AutobrrConfig, seasonName string, year int, a []anime.Anime) error {
+	key := season.Key(seasonName, year)
+	f, err := st.SeasonFilter(key)
+	if err != nil {
+		return err
+	}
+
+	if f == nil {
+		now := time.Now()
+		if !now.Before(season.End(seasonName, year)) {
+			fmt.Printf("\nautobrr filter for %v not created, the season is over\n", key)
+			return nil
+		}
+
+		nf, err := c.DuplicateFilter(ab.SeasonTemplateID)
+		if err != nil {
+			fmt.Printf("\nautobrr filter for %v not created:\n%v\n", key, err)
+			return nil
+		}
+
+		name := strings.NewReplacer("{season}", seasonName, "{year}", strconv.Itoa(year)).Replace(ab.SeasonFilterName)
+		enabled := !now.Before(season.Start(seasonName, year))
+		shows := ""
+		if err := c.UpdateFilter(nf.Id, autobrr.FilterUpdate{Name: &name, Enabled: &enabled, Shows: &shows}); err != nil {
+			fmt.Printf("\nautobrr filter for %v not set up:\n%v\n", key, err)
+			// Drop the copy so the next run starts over instead of leaving
+			// it behind.
+			if err := c.DeleteFilter(nf.Id); err != nil {
+				fmt.Printf("\nautobrr filter %v copied for %v not deleted, delete it in autobrr:\n%v\n", nf.Id, key, err)
+			}
+
+			return nil
+		}
+
+		if err := st.SaveSeasonFilter(key, nf.Id); err != nil {
+			return err
+		}
+
+		fmt.Printf("\nautobrr filter %q (%v) created for %v\n", name, nf.Id, key)
+		f = &state.SeasonFilter{Season: key, FilterID: nf.Id}
+	}
+
+	if f.Retired {
+		fmt.Printf("\nautobrr filter %v for %v is retired, not updated\n", f.FilterID, key)
+		return nil
+	}
+
+	titles := []string{}
+	ids := []int32{}
+	for _, v := range a {
+		titles = append(titles, v.Titles()...)
+		ids = append(ids, v.ID)
+	}
+
+	if err := st.AddSeasonAnime(key, ids); err != nil {
+		return err
+	}
+
+	n, err := c.AddShows(f.FilterID, titles)
+	if err != nil {
+		fmt.Printf("\nautobrr filter %v not updated:\n%v\n", f.FilterID, err)
+		return nil
+	}
+
+	fmt.Printf("\nTitles added to autobrr filter %v for %v: %v\n", f.FilterID, key, n)
+	return nil
+}
+
+// maintainSeasonFilters enables the season filters while their season airs
+// and retires them once it is over or every title of the season is completed
+// or dropped on MAL. statuses are the MAL list statuses already known from
+// the run; the others are looked up.
+func maintainSeasonFilters(c *autobrr.Client, st *state.DB, ab *config.AutobrrConfig, mc *mal.Client, statuses map[int32]string) error {
+	filters, err := st.SeasonFilters()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	retired := []string{}
+	for _, f := range filters {
+		if f.Retired {
+			continue
+		}
+
+		s, y, err := season.ParseKey(f.Season)
+		if err != nil {
+			return err
+		}
+
+		done := !now.Before(season.End(s, y))
+		if !done {
+			done, err = seasonFinished(st, mc, f.Season, statuses)
+			if err != nil {
+				fmt.Printf("\nautobrr filter %v for %v not checked:\n%v\n", f.FilterID, f.Season, err)
+				continue
+			}
+		}
+
+		if done {
+			if ab.RetireAction == "delete" {
+				err = c.DeleteFilter(f.FilterID)
+			} else {
+				enabled := false
+				err = c.UpdateFilter(f.FilterID, autobrr.FilterUpdate{Enabled: &enabled})
+			}
+
+			if err != nil {
+				fmt.Printf("\nautobrr filter %v for %v not retired:\n%v\n", f.FilterID, f.Season, err)
+				continue
+			}
+
+			if err := st.RetireSeasonFilter(f.Season); err != nil {
+				return err
+			}
+
+			retired = append(retired, fmt.Sprintf("%v (%v)", f.Season, f.FilterID))
+			continue
+		}
+
+		af, err := c.GetFilter(f.FilterID)
+		if err != nil {
+			fmt.Printf("\nautobrr filter %v for %v not checked:\n%v\n", f.FilterID, f.Season, err)
+			continue
+		}
+
+		airing := !now.Before(season.Start(s, y))
+		if af.Enabled != airing {
+			if err := c.UpdateFilter(f.FilterID, autobrr.FilterUpdate{Enabled: &airing}); err != nil {
+				fmt.Printf("\nautobrr filter %v for %v not updated:\n%v\n", f.FilterID, f.Season, err)
+			}
+		}
+	}
+
+	if len(retired) > 0 {
+		fmt.Printf("\nFollowing autobrr season filters %vd (%v):\n", ab.RetireAction, len(retired))
+		for _, v := range retired {
+			fmt.Println(v)
+		}
+	}
+
+	return nil
+}
+
+// seasonFinished reports whether every title recorded for the season is
+// completed or dropped on MAL.
+func seasonFinished(st *state.DB, mc *mal.Client, key string, statuses map[int32]string) (bool, error) {
+	ids, err := st.SeasonAnime(key)
+	if err != nil || len(ids) == 0 {
+		return false, err
+	}
+
+	for _, id := range ids {
+		status, ok := statuses[id]
+		if !ok {
+			a, _, err := mc.Anime.Details(context.Background(), int(id), mal.Fields{"my_list_status"})
+			if err != nil {
+				return false, err
+			}
+
+			status = string(a.MyListStatus.Status)
+		}
+
+		if status != string(mal.AnimeStatusCompleted) && status != string(mal.AnimeStatusDropped) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
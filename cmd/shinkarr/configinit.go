@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/radarr"
+	"github.com/varoOP/shinkarr/internal/sonarr"
+)
+
+// runConfigInit walks through the Sonarr and Radarr settings, offering the
+// profiles and root folders of the instances to pick from, and writes
+// config.toml. Only the settings that changed are written; the rest of an
+// existing config, comments included, is kept as it is.
+func runConfigInit(configPath string) {
+	path := filepath.Join(configPath, "config.toml")
+	doc, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+
+	k := koanf.New(".")
+	if err == nil {
+		if err := k.Load(rawbytes.Provider(doc), toml.Parser()); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Editing %v\n", path)
+	} else {
+		fmt.Printf("Creating %v\n", path)
+	}
+
+	f := &configFile{k: k, orig: k.Copy()}
+	p := &prompter{in: bufio.NewReader(os.Stdin)}
+	if p.confirm("Configure Sonarr?", true) {
+		initSonarr(p, f, instanceSection(p, k, "sonarr"))
+	}
+
+	if p.confirm("Configure Radarr?", k.Exists("radarr")) {
+		initRadarr(p, f, instanceSection(p, k, "radarr"))
+	}
+
+	b, err := f.write(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Parse(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if p := validateConfig(cfg); len(p) > 0 {
+		log.Fatalf("config not written, %v", p)
+	}
+
+	if err := os.MkdirAll(configPath, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\nConfig written to %v\n", path)
+}
+
+// configFile is the config being edited. k holds its settings as they are
+// answered and orig as they were; edits lists the keys set or deleted, by
+// table, in order.
+type configFile struct {
+	k      *koanf.Koanf
+	orig   *koanf.Koanf
+	tables []string
+	edits  map[string][]string
+}
+
+func (f *configFile) set(table, key string, v interface{}) {
+	f.k.Set(table+"."+key, v)
+	f.edit(table, key)
+}
+
+func (f *configFile) delete(table, key string) {
+	f.k.Delete(table + "." + key)
+	f.edit(table, key)
+}
+
+func (f *configFile) setDefault(table, key string, v interface{}) {
+	if !f.k.Exists(table + "." + key) {
+		f.set(table, key, v)
+	}
+}
+
+func (f *configFile) edit(table, key string) {
+	if f.edits == nil {
+		f.edits = map[string][]string{}
+	}
+
+	if _, ok := f.edits[table]; !ok {
+		f.tables = append(f.tables, table)
+	}
+
+	for _, v := range f.edits[table] {
+		if v == key {
+			return
+		}
+	}
+
+	f.edits[table] = append(f.edits[table], key)
+}
+
+// write applies the settings that differ from orig to doc.
+func (f *configFile) write(doc []byte) ([]byte, error) {
+	for _, table := range f.tables {
+		edits := []tomlEdit{}
+		for _, key := range f.edits[table] {
+			path := table + "." + key
+			switch {
+			case !f.k.Exists(path):
+				if f.orig.Exists(path) {
+					edits = append(edits, tomlEdit{key: key, remove: true})
+				}
+			case !f.orig.Exists(path) || fmt.Sprint(f.orig.Get(path)) != fmt.Sprint(f.k.Get(path)):
+				edits = append(edits, tomlEdit{key: key, value: f.k.Get(path)})
+			}
+		}
+
+		if len(edits) == 0 {
+			continue
+		}
+
+		var err error
+		if doc, err = editTOML(doc, table, edits); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// instanceSection returns the table the instance is written to: [sonarr]
+// for a single instance, or [sonarr.<name>] if the config already names its
+// instances.
+func instanceSection(p *prompter, k *koanf.Koanf, app string) string {
+	if !k.Exists(app) || k.Exists(app+".Host") || k.Exists(app+".Url") {
+		return app
+	}
+
+	names := k.MapKeys(app)
+	return app + "." + p.ask("Instance name", names[0])
+}
+
+func initSonarr(p *prompter, f *configFile, section string) {
+	k := f.k
+	var (
+		s      *sonarr.Client
+		status *sonarr.SystemStatus
+	)
+
+	promptConnection(p, f, section, "Sonarr", func(cfg *config.Config) error {
+		for _, sc := range cfg.Sonarr {
+			if sc.Path == section {
+				s = sonarr.NewClient(sc)
+			}
+		}
+
+		var err error
+		status, err = s.GetSystemStatus()
+		return err
+	})
+
+	fmt.Printf("Connected to Sonarr %v\n", status.Version)
+	profiles, err := s.GetQualityProfiles()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names := []string{}
+	def := 0
+	for i, v := range profiles {
+		names = append(names, v.Name)
+		if v.Id == int32(k.Int64(section+".QualityProfileID")) || v.Name == k.String(section+".QualityProfile") {
+			def = i
+		}
+	}
+
+	i := p.choose("Quality profile", names, def)
+	f.set(section, "QualityProfileID", int64(profiles[i].Id))
+	f.delete(section, "QualityProfile")
+
+	folders, err := s.GetRootFolders()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := []rootFolder{}
+	for _, v := range folders {
+		r = append(r, rootFolder{Path: v.Path, Accessible: v.Accessible, FreeSpace: v.FreeSpace})
+	}
+
+	f.set(section, "RootFolderPath", chooseRootFolder(p, k.String(section+".RootFolderPath"), r))
+	if status.MajorVersion() == 3 {
+		languages, err := s.GetLanguageProfiles()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		names := []string{}
+		def := 0
+		for i, v := range languages {
+			names = append(names, v.Name)
+			if v.Id == int32(k.Int64(section+".LanguageProfileID")) {
+				def = i
+			}
+		}
+
+		i := p.choose("Language profile", names, def)
+		f.set(section, "LanguageProfileID", int64(languages[i].Id))
+	}
+
+	f.setDefault(section, "SeasonFolder", true)
+	f.setDefault(section, "Monitored", true)
+	f.setDefault(section, "MonitorType", string(sonarr.MonitorTypesAll))
+	f.setDefault(section, "SeriesType", string(sonarr.Anime))
+}
+
+func initRadarr(p *prompter, f *configFile, section string) {
+	k := f.k
+	var (
+		m      *radarr.Client
+		status *radarr.SystemStatus
+	)
+
+	promptConnection(p, f, section, "Radarr", func(cfg *config.Config) error {
+		for _, rc := range cfg.Radarr {
+			if rc.Path == section {
+				m = radarr.NewClient(rc)
+			}
+		}
+
+		var err error
+		status, err = m.GetSystemStatus()
+		return err
+	})
+
+	fmt.Printf("Connected to Radarr %v\n", status.Version)
+	profiles, err := m.GetQualityProfiles()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names := []string{}
+	def := 0
+	for i, v := range profiles {
+		names = append(names, v.Name)
+		if v.Id == int32(k.Int64(section+".QualityProfileID")) || v.Name == k.String(section+".QualityProfile") {
+			def = i
+		}
+	}
+
+	i := p.choose("Quality profile", names, def)
+	f.set(section, "QualityProfileID", int64(profiles[i].Id))
+	f.delete(section, "QualityProfile")
+
+	folders, err := m.GetRootFolders()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := []rootFolder{}
+	for _, v := range folders {
+		r = append(r, rootFolder{Path: v.Path, Accessible: v.Accessible, FreeSpace: v.FreeSpace})
+	}
+
+	f.set(section, "RootFolderPath", chooseRootFolder(p, k.String(section+".RootFolderPath"), r))
+	f.setDefault(section, "Monitored", true)
+	f.setDefault(section, "MonitorType", string(radarr.MonitorTypesMovieOnly))
+	f.setDefault(section, "MinimumAvailability", string(radarr.Released))
+}
+
+func chooseRootFolder(p *prompter, current string, folders []rootFolder) string {
+	if len(folders) == 0 {
+		log.Fatal("no root folders found, add one in the web interface first")
+	}
+
+	names := []string{}
+	def := 0
+	for i, v := range folders {
+		names = append(names, fmt.Sprintf("%v (%v GB free)", v.Path, v.FreeSpace/(1<<30)))
+		if v.Path == current {
+			def = i
+		}
+	}
+
+	return folders[p.choose("Root folder", names, def)].Path
+}
+
+// promptConnection asks for the URL and API key of an instance until test
+// succeeds with them, then stores them in section: as Url if the section
+// has one, as Host, Port, BaseUrl and TLS otherwise. test gets the config
+// with the answers in place, so the other HTTP settings of the section,
+// like Headers or CACertFile, apply to the connection as well.
+func promptConnection(p *prompter, f *configFile, section, app string, test func(*config.Config) error) {
+	k := f.k
+	useUrl := k.Exists(section + ".Url")
+	def := k.String(section + ".Url")
+	if !useUrl && k.Exists(section+".Host") {
+		sc := &config.SonarrConfig{
+			Host:    k.String(section + ".Host"),
+			Port:    k.Int(section + ".Port"),
+			BaseUrl: k.String(section + ".BaseUrl"),
+			TLS:     k.Bool(section + ".TLS"),
+		}
+		sc.BuildUrl()
+		def = sc.Url.String()
+	}
+
+	apiKey := k.String(section + ".ApiKey")
+	for {
+		u, err := url.Parse(p.ask(app+" URL", def))
+		if err != nil || u.Host == "" {
+			fmt.Println("enter a URL like http://localhost:8989")
+			continue
+		}
+
+		def = u.String()
+		apiKey = p.ask(app+" API key", apiKey)
+		answers := connectionKeys(u, useUrl)
+		answers = append(answers, tomlEdit{key: "ApiKey", value: apiKey})
+		if err := testConnection(k, section, answers, test); err != nil {
+			fmt.Printf("cannot connect to %v: %v\n", app, err)
+			continue
+		}
+
+		for _, v := range answers {
+			f.set(section, v.key, v.value)
+		}
+
+		return
+	}
+}
+
+// connectionKeys returns the settings u is stored as.
+func connectionKeys(u *url.URL, useUrl bool) []tomlEdit {
+	if useUrl {
+		return []tomlEdit{{key: "Url", value: u.String()}}
+	}
+
+	tls := u.Scheme == "https"
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		port = 80
+		if tls {
+			port = 443
+		}
+	}
+
+	return []tomlEdit{
+		{key: "Host", value: u.Hostname()},
+		{key: "Port", value: int64(port)},
+		{key: "BaseUrl", value: strings.TrimSuffix(u.Path, "/")},
+		{key: "TLS", value: tls},
+	}
+}
+
+// testConnection runs test on the config as it is with answers set in
+// section.
+func testConnection(k *koanf.Koanf, section string, answers []tomlEdit, test func(*config.Config) error) error {
+	t := k.Copy()
+	for _, v := range answers {
+		t.Set(section+"."+v.key, v.value)
+	}
+
+	b, err := t.Marshal(toml.Parser())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Parse(b)
+	if err != nil {
+		return err
+	}
+
+	return test(cfg)
+}
+
+// prompter reads answers from the terminal.
+type prompter struct {
+	in *bufio.Reader
+}
+
+// ask prints label and returns the answer, or def if the answer is empty.
+func (p *prompter) ask(label, def string) string {
+	if def != "" {
+		fmt.Printf("%v [%v]: ", label, def)
+	} else {
+		fmt.Printf("%v: ", label)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal("no answer given")
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+
+	return line
+}
+
+func (p *prompter) confirm(label string, def bool) bool {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+
+	for {
+		switch strings.ToLower(p.ask(label+" ("+d+")", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// choose lists options and returns the index of the one picked.
+func (p *prompter) choose(label string, options []string, def int) int {
+	fmt.Printf("\n%v:\n", label)
+	for i, v := range options {
+		fmt.Printf("  %v) %v\n", i+1, v)
+	}
+
+	for {
+		n, err := strconv.Atoi(p.ask("Pick one", strconv.Itoa(def+1)))
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1
+		}
+
+		fmt.Printf("enter a number from 1 to %v\n", len(options))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/database"
+	"github.com/varoOP/shinkarr/internal/schedule"
+	"github.com/varoOP/shinkarr/internal/season"
+	"github.com/varoOP/shinkarr/internal/state"
+)
+
+// runDaemon syncs the current season, and the next one with NextSeason, on
+// the cron schedule of the daemon section. The MAL client, rules and routes
+// are kept between runs, the instances are set up again by each; a run
+// that fails is logged and everything is set up again for the next one.
+func runDaemon(cfg *config.Config, configPath string, db *database.DB, st *state.DB) {
+	sched, err := schedule.Parse(cfg.Daemon.Schedule)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d := &daemon{cfg: cfg, configPath: configPath, db: db, st: st}
+	log.Printf("daemon started, schedule %q", cfg.Daemon.Schedule)
+	if cfg.Daemon.RunOnStart {
+		d.run()
+	}
+
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			log.Fatalf("schedule %q never runs", cfg.Daemon.Schedule)
+		}
+
+		log.Printf("next run at %v", next.Format(time.RFC1123))
+		time.Sleep(time.Until(next))
+		d.run()
+	}
+}
+
+type daemon struct {
+	cfg        *config.Config
+	configPath string
+	db         *database.DB
+	st         *state.DB
+	syncer     *syncer
+}
+
+// run syncs the seasons due now. It never exits the daemon.
+func (d *daemon) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("run failed: %v", r)
+			d.syncer = nil
+		}
+	}()
+
+	l, err := acquireLock(d.configPath)
+	if err != nil {
+		log.Printf("run skipped: %v", err)
+		return
+	}
+
+	defer l.release()
+	if d.syncer == nil {
+		s, err := newSyncer(d.cfg, d.db, d.st)
+		if err != nil {
+			log.Printf("run failed: %v", err)
+			return
+		}
+
+		d.syncer = s
+	}
+
+	for _, key := range d.seasons(time.Now()) {
+		name, year, _ := season.ParseKey(key)
+		log.Printf("syncing %v", key)
+		if err := d.syncer.run(name, year); err != nil {
+			log.Printf("sync of %v failed: %v", key, err)
+			d.syncer = nil
+			return
+		}
+	}
+
+	log.Print("run finished")
+}
+
+// seasons returns the keys of the seasons to sync at t.
+func (d *daemon) seasons(t time.Time) []string {
+	name, year := season.Of(t)
+	keys := []string{season.Key(name, year)}
+	if d.cfg.Daemon.NextSeason {
+		keys = append(keys, season.Key(season.Next(name, year)))
+	}
+
+	return keys
+}
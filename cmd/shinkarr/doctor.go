@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+	"github.com/varoOP/shinkarr/internal/autobrr"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/database"
+	"github.com/varoOP/shinkarr/internal/maloauth"
+	"github.com/varoOP/shinkarr/internal/rules"
+)
+
+// mappingMaxAge is how old the community mapping can get before doctor
+// warns about it.
+const mappingMaxAge = 180 * 24 * time.Hour
+
+type checkResult struct {
+	Check  string
+	Result string
+	Detail string
+	Hint   string
+}
+
+type doctor struct {
+	results []checkResult
+}
+
+func (d *doctor) pass(check, detail string) {
+	d.results = append(d.results, checkResult{Check: check, Result: "PASS", Detail: detail})
+}
+
+func (d *doctor) warn(check, detail, hint string) {
+	d.results = append(d.results, checkResult{Check: check, Result: "WARN", Detail: detail, Hint: hint})
+}
+
+func (d *doctor) fail(check, detail, hint string) {
+	d.results = append(d.results, checkResult{Check: check, Result: "FAIL", Detail: detail, Hint: hint})
+}
+
+// runDoctor checks everything a run depends on and prints a table of the
+// results. It returns false if any check failed.
+func runDoctor(configPath, dbPath string) bool {
+	d := &doctor{}
+	cfg := d.checkConfig(configPath)
+	d.checkShinkroDB(dbPath)
+	if cfg != nil {
+		d.checkInstances(cfg)
+	}
+
+	d.checkMappings()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL\tHINT")
+	ok := true
+	for _, r := range d.results {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Check, r.Result, r.Detail, r.Hint)
+		ok = ok && r.Result != "FAIL"
+	}
+
+	w.Flush()
+	return ok
+}
+
+func (d *doctor) checkConfig(configPath string) *config.Config {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		d.fail("config", err.Error(), "fix the syntax of config.toml in "+configPath)
+		return nil
+	}
+
+	if problems := validateConfig(cfg); len(problems) > 0 {
+		for _, p := range problems {
+			d.fail("config", p.String(), configHint(p))
+		}
+
+		return nil
+	}
+
+	d.pass("config", "config.toml parsed")
+
+	if _, err := rules.NewSet(cfg.Rules); err != nil {
+		d.fail("rules", err.Error(), "fix the Expr of the rule")
+	} else {
+		d.pass("rules", fmt.Sprintf("%v rules compiled", len(cfg.Rules)))
+	}
+
+	if _, err := rules.NewRouter(cfg); err != nil {
+		d.fail("routes", err.Error(), "fix the route or the instance names it refers to")
+	} else {
+		d.pass("routes", fmt.Sprintf("%v routes compiled", len(cfg.Routes)))
+	}
+
+	return cfg
+}
+
+func configHint(p config.Problem) string {
+	switch {
+	case p.Message == "unknown key":
+		return "check the spelling against the sample config.toml"
+	case p.Message == "required":
+		return "set it in config.toml or run shinkarr config init"
+	}
+
+	return ""
+}
+
+func (d *doctor) checkShinkroDB(dbPath string) {
+	if _, err := os.Stat(dbPath); err != nil {
+		d.fail("shinkro db", err.Error(), "run shinkro once or point --shinkro-db at shinkro.db")
+		d.fail("mal token", "shinkro db not available", "")
+		return
+	}
+
+	db, err := database.OpenReadOnly(dbPath)
+	if err != nil {
+		d.fail("shinkro db", err.Error(), "check that the file is a shinkro database")
+		d.fail("mal token", "shinkro db not available", "")
+		return
+	}
+
+	defer db.Handler.Close()
+
+	missing := []string{}
+	for _, table := range []string{"malauth", "anime"} {
+		ok, err := db.HasTable(table)
+		if err != nil {
+			d.fail("shinkro db", err.Error(), "check that the file is a shinkro database")
+			return
+		}
+
+		if !ok {
+			missing = append(missing, table)
+		}
+	}
+
+	if len(missing) > 0 {
+		d.fail("shinkro db", "missing tables: "+strings.Join(missing, ", "), "update shinkro and let it finish its setup")
+		return
+	}
+
+	d.pass("shinkro db", dbPath)
+	d.checkMALToken(db)
+}
+
+func (d *doctor) checkMALToken(db *database.DB) {
+	ctx := context.Background()
+	cfg, t, err := maloauth.Token(db)
+	if err != nil {
+		d.fail("mal token", err.Error(), "authenticate with MAL in shinkro")
+		return
+	}
+
+	fresh, err := cfg.TokenSource(ctx, t).Token()
+	if err != nil {
+		d.fail("mal token", "refresh failed: "+err.Error(), "authenticate with MAL in shinkro again")
+		return
+	}
+
+	u, _, err := mal.NewClient(cfg.Client(ctx, fresh)).User.MyInfo(ctx)
+	if err != nil {
+		d.fail("mal token", err.Error(), "authenticate with MAL in shinkro again")
+		return
+	}
+
+	if fresh.AccessToken != t.AccessToken {
+		d.pass("mal token", fmt.Sprintf("refreshed for %v, expires %v", u.Name, fresh.Expiry.Format(time.DateOnly)))
+		return
+	}
+
+	d.pass("mal token", fmt.Sprintf("valid for %v, expires %v", u.Name, t.Expiry.Format(time.DateOnly)))
+}
+
+func (d *doctor) checkInstances(cfg *config.Config) {
+	if len(cfg.Sonarr) == 0 && len(cfg.Radarr) == 0 {
+		d.warn("instances", "no Sonarr or Radarr configured", "add a [sonarr] or [radarr] section")
+		return
+	}
+
+	for _, sc := range cfg.Sonarr {
+		_, problems := newSonarrInstance(sc)
+		d.instanceResult("sonarr "+sc.Name, sc.Url.String(), problems)
+	}
+
+	for _, rc := range cfg.Radarr {
+		_, problems := newRadarrInstance(rc)
+		d.instanceResult("radarr "+rc.Name, rc.Url.String(), problems)
+	}
+
+	if cfg.Autobrr != nil && cfg.Autobrr.FilterID != 0 {
+		f, err := autobrr.NewClient(cfg.Autobrr).GetFilter(cfg.Autobrr.FilterID)
+		if err != nil {
+			d.fail("autobrr", err.Error(), "check the autobrr address, API key and FilterID")
+			return
+		}
+
+		d.pass("autobrr", fmt.Sprintf("filter %v %q", f.Id, f.Name))
+	}
+}
+
+func (d *doctor) instanceResult(check, url string, problems []string) {
+	if len(problems) == 0 {
+		d.pass(check, url)
+		return
+	}
+
+	for _, p := range problems {
+		d.fail(check, p, instanceHint(p))
+	}
+}
+
+func instanceHint(problem string) string {
+	switch {
+	case strings.Contains(problem, "401"):
+		return "copy the API key from Settings > General"
+	case strings.Contains(problem, "cannot connect"):
+		return "check Url, or Host, Port, BaseUrl and TLS"
+	case strings.Contains(problem, "not supported"):
+		return "upgrade to v3 or later"
+	case strings.Contains(problem, "does not exist"):
+		return "pick one of the available values"
+	case strings.Contains(problem, "free"), strings.Contains(problem, "accessible"):
+		return "free up space or fix the mount"
+	}
+
+	return ""
+}
+
+func (d *doctor) checkMappings() {
+	for _, name := range database.CommunityMaps {
+		updated, err := database.MapUpdated(name)
+		if err != nil {
+			d.fail("mapping "+name, err.Error(), "check access to github.com")
+			continue
+		}
+
+		age := time.Since(updated)
+		detail := fmt.Sprintf("updated %v", updated.Format(time.DateOnly))
+		if age > mappingMaxAge {
+			d.warn("mapping "+name, detail, "new titles may not be mapped yet; add them to shinkro-mapping")
+			continue
+		}
+
+		d.pass("mapping "+name, detail)
+	}
+}
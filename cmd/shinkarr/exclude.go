@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/varoOP/shinkarr/internal/anime"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/database"
+	"github.com/varoOP/shinkarr/internal/state"
+)
+
+// runExclude keeps the MAL title from ever being added again: it is recorded
+// in the shinkarr state and added to the import list exclusions of the
+// instances it is routed to. In Sonarr only titles that start their series
+// are excluded, since the exclusion covers every season.
+func runExclude(cfg *config.Config, db *database.DB, st *state.DB, arg string) {
+	malid, err := strconv.Atoi(arg)
+	if err != nil || malid <= 0 {
+		log.Fatalf("invalid mal id: %q", arg)
+	}
+
+	s, err := newSyncer(cfg, db, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := s.exclude(int32(malid)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (sy *syncer) exclude(malid int32) error {
+	if err := sy.connect(); err != nil {
+		return err
+	}
+
+	m, _, err := sy.mal.Anime.Details(context.Background(), int(malid), anime.Fields)
+	if err != nil {
+		return err
+	}
+
+	maps, err := database.LoadMaps()
+	if err != nil {
+		return fmt.Errorf("loading the community mapping: %w", err)
+	}
+
+	v := anime.FromMAL(*m)
+	if err := sy.st.AddExclusion(v.ID, v.Title); err != nil {
+		return err
+	}
+
+	fmt.Printf("%v (https://myanimelist.net/anime/%v) excluded in shinkarr\n", v.Title, v.ID)
+	t, err := sy.router.Route(v.Env())
+	if err != nil {
+		return err
+	}
+
+	series, movies := []int32{}, []int32{}
+	switch sy.cfg.MAL.Target(v.MediaType) {
+	case "sonarr":
+		series = append(series, v.ID)
+	case "radarr":
+		movies = append(movies, v.ID)
+	}
+
+	series, movies, crossed, err := crossRoute(sy.db, maps, series, movies)
+	if err != nil {
+		return err
+	}
+
+	target := ""
+	switch {
+	case len(series) > 0:
+		target = "sonarr"
+	case len(movies) > 0:
+		target = "radarr"
+	}
+
+	switch target {
+	case "sonarr":
+		ids, err := sy.db.LookupIDs([]int32{v.ID}, "tvdb", maps)
+		if err != nil {
+			return err
+		}
+
+		tvdbid, ok := ids[v.ID]
+		if !ok {
+			fmt.Println("no tvdb id found, not excluded in Sonarr")
+			return nil
+		}
+
+		// The exclusion is for the whole series, so it is only pushed for
+		// the title that starts it, not for a sequel or special of a show
+		// the user may still want.
+		if _, ok := crossed[v.ID]; ok {
+			fmt.Println("film sent to Sonarr as a special, not excluded in Sonarr")
+			return nil
+		}
+
+		if !startsSeries(maps.TVDB.Find(int(v.ID))) {
+			fmt.Printf("not the first season of tvdb id %v, not excluded in Sonarr\n", tvdbid)
+			return nil
+		}
+
+		for _, si := range sy.sonarrs {
+			if !t.HasSonarr(si.cfg.Name) {
+				continue
+			}
+
+			if err := si.client.AddExclusion(tvdbid, v.Title); err != nil {
+				return fmt.Errorf("%v: %w", si.cfg.Path, err)
+			}
+
+			fmt.Printf("tvdb id %v excluded in %v\n", tvdbid, si.cfg.Path)
+		}
+
+	case "radarr":
+		ids, err := sy.db.LookupIDs([]int32{v.ID}, "tmdb", maps)
+		if err != nil {
+			return err
+		}
+
+		tmdbid, ok := ids[v.ID]
+		if !ok {
+			fmt.Println("no tmdb id found, not excluded in Radarr")
+			return nil
+		}
+
+		for _, ri := range sy.radarrs {
+			if !t.HasRadarr(ri.cfg.Name) {
+				continue
+			}
+
+			if err := ri.client.AddExclusion(tmdbid, v.Title, int32(v.StartYear)); err != nil {
+				return fmt.Errorf("%v: %w", ri.cfg.Path, err)
+			}
+
+			fmt.Printf("tmdb id %v excluded in %v\n", tmdbid, ri.cfg.Path)
+		}
+	}
+
+	return nil
+}
+
+// startsSeries reports whether the mapping puts the title at the start of
+// the first season of its series.
+func startsSeries(m *database.Anime) bool {
+	if m == nil {
+		return false
+	}
+
+	first := m.Seasons()[0]
+	return first.TvdbSeason == 1 && first.Start <= 1
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/radarr"
+	"github.com/varoOP/shinkarr/internal/sonarr"
+)
+
+// sonarrInstance is a Sonarr client together with the quality profiles and
+// root folders of the instance, fetched at the start of each run.
+type sonarrInstance struct {
+	cfg      *config.SonarrConfig
+	client   *sonarr.Client
+	tags     *tagger
+	profiles map[string]int32
+	folders  map[string]bool
+}
+
+// newSonarrInstance connects to the instance and checks the config against
+// it. It returns every problem found; the instance is nil when it could
+// not be reached at all.
+func newSonarrInstance(sc *config.SonarrConfig) (*sonarrInstance, []string) {
+	s := sonarr.NewClient(sc)
+	status, err := s.GetSystemStatus()
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%v: cannot connect to %v: %v", sc.Name, sc.Url, err)}
+	}
+
+	problems := []string{}
+	if status.MajorVersion() < 3 {
+		problems = append(problems, fmt.Sprintf("%v: Sonarr %v is not supported, v3 or later is required", sc.Name, status.Version))
+	}
+
+	p, err := s.GetQualityProfiles()
+	if err != nil {
+		return nil, append(problems, fmt.Sprintf("%v: %v", sc.Name, err))
+	}
+
+	r, err := s.GetRootFolders()
+	if err != nil {
+		return nil, append(problems, fmt.Sprintf("%v: %v", sc.Name, err))
+	}
+
+	i := &sonarrInstance{
+		cfg:      sc,
+		client:   s,
+		tags:     newTagger(s),
+		profiles: map[string]int32{},
+		folders:  map[string]bool{},
+	}
+
+	available := []string{}
+	for _, v := range p {
+		i.profiles[v.Name] = v.Id
+		available = append(available, fmt.Sprintf("%v %v", v.Id, v.Name))
+	}
+
+	folders := []rootFolder{}
+	for _, v := range r {
+		i.folders[v.Path] = true
+		folders = append(folders, rootFolder{Path: v.Path, Accessible: v.Accessible, FreeSpace: v.FreeSpace})
+	}
+
+	if status.MajorVersion() == 3 {
+		l, err := s.GetLanguageProfiles()
+		if err != nil {
+			return nil, append(problems, fmt.Sprintf("%v: %v", sc.Name, err))
+		}
+
+		languages := []string{}
+		found := false
+		for _, v := range l {
+			languages = append(languages, fmt.Sprintf("%v %v", v.Id, v.Name))
+			found = found || v.Id == sc.LanguageProfileID
+		}
+
+		if !found {
+			problems = append(problems, fmt.Sprintf("%v: LanguageProfileID %v does not exist (available: %v)", sc.Name, sc.LanguageProfileID, strings.Join(languages, ", ")))
+		}
+	}
+
+	if sc.QualityProfile != "" {
+		id, ok := i.profiles[sc.QualityProfile]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%v: QualityProfile %q does not exist (available: %v)", sc.Name, sc.QualityProfile, strings.Join(available, ", ")))
+		}
+
+		sc.QualityProfileID = id
+	} else if !hasProfile(i.profiles, sc.QualityProfileID) {
+		problems = append(problems, fmt.Sprintf("%v: QualityProfileID %v does not exist (available: %v)", sc.Name, sc.QualityProfileID, strings.Join(available, ", ")))
+	}
+
+	problems = append(problems, checkRootFolder(sc.Name, sc.RootFolderPath, sc.MinFreeSpaceGB, folders)...)
+	for status, rule := range sc.Lifecycle {
+		if rule.QualityProfileID != 0 && !hasProfile(i.profiles, rule.QualityProfileID) {
+			problems = append(problems, fmt.Sprintf("%v: Lifecycle.%v: QualityProfileID %v does not exist (available: %v)", sc.Name, status, rule.QualityProfileID, strings.Join(available, ", ")))
+		}
+
+		if rule.RootFolderPath != "" && !i.folders[rule.RootFolderPath] {
+			problems = append(problems, fmt.Sprintf("%v: Lifecycle.%v: root folder %q does not exist", sc.Name, status, rule.RootFolderPath))
+		}
+	}
+
+	return i, problems
+}
+
+func hasProfile(profiles map[string]int32, id int32) bool {
+	for _, v := range profiles {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+type rootFolder struct {
+	Path       string
+	Accessible bool
+	FreeSpace  int64
+}
+
+// checkRootFolder reports whether path is a root folder of the instance that
+// is accessible and has at least minFreeGB of free space.
+func checkRootFolder(name, path string, minFreeGB int64, folders []rootFolder) []string {
+	available := []string{}
+	for _, v := range folders {
+		if v.Path != path {
+			available = append(available, v.Path)
+			continue
+		}
+
+		if !v.Accessible {
+			return []string{fmt.Sprintf("%v: root folder %q is not accessible", name, path)}
+		}
+
+		if free := v.FreeSpace / (1 << 30); free < minFreeGB {
+			return []string{fmt.Sprintf("%v: root folder %q has %v GB free, less than MinFreeSpaceGB (%v)", name, path, free, minFreeGB)}
+		}
+
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%v: RootFolderPath %q does not exist (available: %v)", name, path, strings.Join(available, ", "))}
+}
+
+// check reports the overrides that don't exist on the instance.
+func (i *sonarrInstance) check(o config.SonarrOverrides) error {
+	if _, ok := i.profiles[o.QualityProfile]; o.QualityProfile != "" && !ok {
+		return fmt.Errorf("%v: quality profile %q not found", i.cfg.Name, o.QualityProfile)
+	}
+
+	if o.RootFolderPath != "" && !i.folders[o.RootFolderPath] {
+		return fmt.Errorf("%v: root folder %q not found", i.cfg.Name, o.RootFolderPath)
+	}
+
+	return nil
+}
+
+func (i *sonarrInstance) options(o config.SonarrOverrides, search bool) sonarr.SeriesOptions {
+	opts := i.client.NewSeriesOptions()
+	opts.Search = search
+	if o.QualityProfile != "" {
+		opts.QualityProfileId = i.profiles[o.QualityProfile]
+	}
+
+	if o.RootFolderPath != "" {
+		opts.RootFolderPath = o.RootFolderPath
+	}
+
+	if o.SeriesType != "" {
+		opts.SeriesType = sonarr.SeriesTypes(o.SeriesType)
+	}
+
+	if o.SeasonFolder != nil {
+		opts.SeasonFolder = *o.SeasonFolder
+	}
+
+	return opts
+}
+
+// radarrInstance is the Radarr counterpart of sonarrInstance.
+type radarrInstance struct {
+	cfg      *config.RadarrConfig
+	client   *radarr.Client
+	tags     *tagger
+	profiles map[string]int32
+	folders  map[string]bool
+}
+
+func newRadarrInstance(rc *config.RadarrConfig) (*radarrInstance, []string) {
+	m := radarr.NewClient(rc)
+	status, err := m.GetSystemStatus()
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%v: cannot connect to %v: %v", rc.Name, rc.Url, err)}
+	}
+
+	problems := []string{}
+	if status.MajorVersion() < 3 {
+		problems = append(problems, fmt.Sprintf("%v: Radarr %v is not supported, v3 or later is required", rc.Name, status.Version))
+	}
+
+	p, err := m.GetQualityProfiles()
+	if err != nil {
+		return nil, append(problems, fmt.Sprintf("%v: %v", rc.Name, err))
+	}
+
+	r, err := m.GetRootFolders()
+	if err != nil {
+		return nil, append(problems, fmt.Sprintf("%v: %v", rc.Name, err))
+	}
+
+	i := &radarrInstance{
+		cfg:      rc,
+		client:   m,
+		tags:     newTagger(m),
+		profiles: map[string]int32{},
+		folders:  map[string]bool{},
+	}
+
+	available := []string{}
+	for _, v := range p {
+		i.profiles[v.Name] = v.Id
+		available = append(available, fmt.Sprintf("%v %v", v.Id, v.Name))
+	}
+
+	folders := []rootFolder{}
+	for _, v := range r {
+		i.folders[v.Path] = true
+		folders = append(folders, rootFolder{Path: v.Path, Accessible: v.Accessible, FreeSpace: v.FreeSpace})
+	}
+
+	if rc.QualityProfile != "" {
+		id, ok := i.profiles[rc.QualityProfile]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%v: QualityProfile %q does not exist (available: %v)", rc.Name, rc.QualityProfile, strings.Join(available, ", ")))
+		}
+
+		rc.QualityProfileID = id
+	} else if !hasProfile(i.profiles, rc.QualityProfileID) {
+		problems = append(problems, fmt.Sprintf("%v: QualityProfileID %v does not exist (available: %v)", rc.Name, rc.QualityProfileID, strings.Join(available, ", ")))
+	}
+
+	problems = append(problems, checkRootFolder(rc.Name, rc.RootFolderPath, rc.MinFreeSpaceGB, folders)...)
+	return i, problems
+}
+
+func (i *radarrInstance) check(o config.RadarrOverrides) error {
+	if _, ok := i.profiles[o.QualityProfile]; o.QualityProfile != "" && !ok {
+		return fmt.Errorf("%v: quality profile %q not found", i.cfg.Name, o.QualityProfile)
+	}
+
+	if o.RootFolderPath != "" && !i.folders[o.RootFolderPath] {
+		return fmt.Errorf("%v: root folder %q not found", i.cfg.Name, o.RootFolderPath)
+	}
+
+	return nil
+}
+
+func (i *radarrInstance) options(o config.RadarrOverrides, search bool) radarr.MovieOptions {
+	opts := i.client.NewMovieOptions()
+	opts.Search = opts.Search || search
+	if o.QualityProfile != "" {
+		opts.QualityProfileId = i.profiles[o.QualityProfile]
+	}
+
+	if o.RootFolderPath != "" {
+		opts.RootFolderPath = o.RootFolderPath
+	}
+
+	if o.MinimumAvailability != "" {
+		opts.MinimumAvailability = radarr.MovieStatusType(o.MinimumAvailability)
+	}
+
+	return opts
+}
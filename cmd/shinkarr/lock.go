@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// runLock keeps two syncs, like a daemon run and one started by hand, from
+// working on the same instances at once.
+type runLock struct {
+	f *os.File
+}
+
+// acquireLock locks shinkarr.lock in the config directory and writes the pid
+// of this process to it. The lock goes away with the process, so one left
+// behind by a crash or a container restart doesn't block the next run.
+func acquireLock(configPath string) (*runLock, error) {
+	path := filepath.Join(configPath, "shinkarr.lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			b, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("another run is in progress (pid %v, %v)", strings.TrimSpace(string(b)), path)
+		}
+
+		return nil, err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintln(f, os.Getpid()); err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+
+	return &runLock{f: f}, nil
+}
+
+// release unlocks the file. It is left in place, since removing it could
+// let a run that is waiting lock a file no one else sees.
+func (l *runLock) release() {
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	l.f.Close()
+}
@@ -0,0 +1,38 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockFile treats the file as locked while it holds the pid of another
+// process that is running, as there is no flock(2) to rely on.
+func lockFile(f *os.File) error {
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid == os.Getpid() {
+		return nil
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+
+	if err := p.Signal(syscall.Signal(0)); err == nil || errors.Is(err, syscall.EPERM) {
+		return errLocked
+	}
+
+	return nil
+}
+
+func unlockFile(f *os.File) {}
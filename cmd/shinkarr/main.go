@@ -1,19 +1,17 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
-	"github.com/nstratos/go-myanimelist/mal"
 	"github.com/spf13/pflag"
-	"github.com/varoOP/shinkarr/internal/config"
 	"github.com/varoOP/shinkarr/internal/database"
-	"github.com/varoOP/shinkarr/internal/maloauth"
-	"github.com/varoOP/shinkarr/internal/radarr"
-	"github.com/varoOP/shinkarr/internal/sonarr"
+	"github.com/varoOP/shinkarr/internal/season"
+	"github.com/varoOP/shinkarr/internal/state"
 )
 
 func main() {
@@ -21,7 +19,12 @@ func main() {
 		configPath string
 		dbPath     string
 		seasonYear int
-		season     string
+		seasonName string
+		from       string
+		to         string
+		tag        string
+		redact     bool
+		deleted    bool
 	)
 
 	d, err := homedir.Dir()
@@ -31,144 +34,116 @@ func main() {
 
 	pflag.StringVar(&dbPath, "shinkro-db", filepath.Join(d, ".config/shinkro/shinkro.db"), "path to shinkro.db")
 	pflag.StringVar(&configPath, "config", filepath.Join(d, ".config/shinkarr"), "path to shinkarr configuration directory")
-	pflag.IntVar(&seasonYear, "season-year", 0, "season year of anime")
-	pflag.StringVar(&season, "season", "", "season of anime")
+	pflag.IntVar(&seasonYear, "season-year", 0, "season year of anime, derived from the date if not given")
+	pflag.StringVar(&seasonName, "season", "", "season of anime: current, next, previous, winter, spring, summer or fall")
+	pflag.StringVar(&from, "from", "", "first season of a range to sync, like winter-2023")
+	pflag.StringVar(&to, "to", "current", "last season of a range to sync, like spring-2024")
+	pflag.StringVar(&tag, "tag", "", "tag of the series and movies to search for (search command)")
+	pflag.BoolVar(&redact, "redact", false, "hide API keys in the output (config show command)")
+	pflag.BoolVar(&deleted, "include-deleted", false, "add titles again that were deleted from Sonarr or Radarr after shinkarr added them")
 	pflag.Parse()
 
-	if seasonYear == 0 || season == "" {
-		log.Fatal("season-year or season not provided")
-	}
+	switch pflag.Arg(0) {
+	case "doctor":
+		if !runDoctor(configPath, dbPath) {
+			os.Exit(1)
+		}
 
-	dsn := dbPath + "?_pragma=busy_timeout%3d1000"
-	db := database.NewDB(dsn)
-	cfg := config.NewConfig(configPath)
-	oc := maloauth.NewOauth2Client(db)
-	c := mal.NewClient(oc)
-
-	a, _, err := c.Anime.Seasonal(
-		context.Background(),
-		seasonYear,
-		mal.AnimeSeason(season),
-		mal.Fields{
-			"alternative_titles{en}",
-			"my_list_status{status}",
-			"media_type",
-		},
-		mal.NSFW(true),
-		mal.Limit(500),
-		mal.SortSeasonalByAnimeNumListUsers,
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
+		return
 
-	//aa := []mal.Anime{}
-	malIdsSeries := []int32{}
-	malIdsMovies := []int32{}
-	for _, anime := range a {
-		if anime.MyListStatus.Status == mal.AnimeStatusPlanToWatch || anime.MyListStatus.Status == mal.AnimeStatusWatching {
-			//		aa = append(aa, anime)
-			if anime.MediaType == "movie" {
-				malIdsMovies = append(malIdsMovies, int32(anime.ID))
-				continue
-			}
-
-			malIdsSeries = append(malIdsSeries, int32(anime.ID))
+	case "config":
+		switch pflag.Arg(1) {
+		case "init":
+			runConfigInit(configPath)
+		case "show":
+			runConfigShow(configPath, redact)
+		default:
+			log.Fatalf("unknown config command: %v", pflag.Arg(1))
 		}
-	}
-	fmt.Println("Total number of anime series we wish to add: ", len(malIdsSeries))
-	fmt.Println("Total number of anime movies we wish to add: ", len(malIdsMovies))
 
-	animeTv, err := db.GetIDs(malIdsSeries, "tvdb")
-	if err != nil {
-		log.Fatal(err)
+		return
 	}
 
-	animeMovie, err := db.GetIDs(malIdsMovies, "tmdb")
-	if err != nil {
-		log.Fatal(err)
-	}
+	cfg := loadConfig(configPath)
 
-	s := sonarr.NewClient(cfg)
-	tag := fmt.Sprintf("%v-%v", season, seasonYear)
-	tagExists, tagId, err := s.TagExists(tag)
-	if err != nil {
-		log.Fatal(err)
-	}
+	switch pflag.Arg(0) {
+	case "search":
+		if tag == "" {
+			log.Fatal("tag not provided")
+		}
+
+		runSearch(cfg, tag)
 
-	if !tagExists {
-		tagId, err = s.AddTag(tag)
+	case "":
+		seasons, err := syncSeasons(seasonName, seasonYear, from, to, time.Now())
 		if err != nil {
 			log.Fatal(err)
 		}
-	}
-
-	seriesAdded := []string{}
-	seriesNotAdded := []string{}
 
-	for title, id := range animeTv {
-		err := s.AddSeries(title, id, []int32{tagId})
+		dsn := dbPath + "?_pragma=busy_timeout%3d1000"
+		db := database.NewDB(dsn)
+		st := state.NewDB(filepath.Join(configPath, "shinkarr.db") + "?_pragma=busy_timeout%3d1000")
+		l, err := acquireLock(configPath)
 		if err != nil {
-			seriesNotAdded = append(seriesNotAdded, fmt.Sprintf("%v\nerror:%v\n", title, err))
-			continue
+			log.Fatal(err)
 		}
 
-		seriesAdded = append(seriesAdded, title)
-	}
+		defer l.release()
+		runSync(cfg, db, st, seasons, deleted)
 
-	if len(seriesAdded) > 0 {
-		fmt.Printf("\nFollowing series added (%v):\n", len(seriesAdded))
-		for _, v := range seriesAdded {
-			fmt.Println(v)
-		}
-	}
+	case "daemon":
+		db := database.NewDB(dbPath + "?_pragma=busy_timeout%3d1000")
+		st := state.NewDB(filepath.Join(configPath, "shinkarr.db") + "?_pragma=busy_timeout%3d1000")
+		runDaemon(cfg, configPath, db, st)
 
-	if len(seriesNotAdded) > 0 {
-		fmt.Printf("\nFollowing series not added (%v):\n", len(seriesNotAdded))
-		for _, v := range seriesNotAdded {
-			fmt.Println(v)
+	case "exclude":
+		if pflag.Arg(1) == "" {
+			log.Fatal("mal id not provided")
 		}
-	}
 
-	m := radarr.NewClient(cfg)
-	tag = fmt.Sprintf("%v-%v", season, seasonYear)
-	tagExists, tagId, err = m.TagExists(tag)
-	if err != nil {
-		log.Fatal(err)
+		db := database.NewDB(dbPath + "?_pragma=busy_timeout%3d1000")
+		st := state.NewDB(filepath.Join(configPath, "shinkarr.db") + "?_pragma=busy_timeout%3d1000")
+		runExclude(cfg, db, st, pflag.Arg(1))
+
+	case "serve":
+		db := database.NewDB(dbPath + "?_pragma=busy_timeout%3d1000")
+		st := state.NewDB(filepath.Join(configPath, "shinkarr.db") + "?_pragma=busy_timeout%3d1000")
+		runServe(cfg, db, st)
+
+	default:
+		log.Fatalf("unknown command: %v", pflag.Arg(0))
 	}
+}
 
-	if !tagExists {
-		tagId, err = m.AddTag(tag)
-		if err != nil {
-			log.Fatal(err)
+// syncSeasons returns the keys of the seasons a sync covers, either the one
+// of --season and --season-year or the range of --from and --to.
+func syncSeasons(name string, year int, from, to string, now time.Time) ([]string, error) {
+	if from != "" {
+		if name != "" || year != 0 {
+			return nil, fmt.Errorf("season and season-year can't be combined with from")
 		}
-	}
 
-	moviesAdded := []string{}
-	moviesNotAdded := []string{}
+		fromName, fromYear, err := season.Parse(from, now)
+		if err != nil {
+			return nil, err
+		}
 
-	for title, id := range animeMovie {
-		err := m.AddMovie(title, id, []int32{tagId})
+		toName, toYear, err := season.Parse(to, now)
 		if err != nil {
-			moviesNotAdded = append(moviesNotAdded, fmt.Sprintf("%v\nerror:%v\n", title, err))
-			continue
+			return nil, err
 		}
 
-		moviesAdded = append(moviesAdded, title)
+		return season.Range(fromName, fromYear, toName, toYear)
 	}
 
-	if len(moviesAdded) > 0 {
-		fmt.Printf("\nFollowing movies added (%v):\n", len(moviesAdded))
-		for _, v := range moviesAdded {
-			fmt.Println(v)
-		}
+	if name == "" {
+		return nil, fmt.Errorf("season or from not provided")
 	}
 
-	if len(moviesNotAdded) > 0 {
-		fmt.Printf("\nFollowing movies not added (%v):\n", len(moviesNotAdded))
-		for _, v := range moviesNotAdded {
-			fmt.Println(v)
-		}
+	name, year, err := season.Resolve(name, year, now)
+	if err != nil {
+		return nil, err
 	}
 
+	return []string{season.Key(name, year)}, nil
 }
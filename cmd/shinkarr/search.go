@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/radarr"
+	"github.com/varoOP/shinkarr/internal/sonarr"
+)
+
+// runSearch queues a search in every Sonarr and Radarr instance for
+// everything carrying tag.
+func runSearch(cfg *config.Config, tag string) {
+	for _, sc := range cfg.Sonarr {
+		searchSeries(sonarr.NewClient(sc), sc.Name, tag)
+	}
+
+	for _, rc := range cfg.Radarr {
+		searchMovies(radarr.NewClient(rc), rc.Name, tag)
+	}
+}
+
+func searchSeries(s *sonarr.Client, name, tag string) {
+	tagExists, tagId, err := s.TagExists(tag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !tagExists {
+		fmt.Printf("tag %v not found in %v\n", tag, name)
+		return
+	}
+
+	series, err := s.GetAllSeries()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	searched := []string{}
+	notSearched := []string{}
+	for _, v := range series {
+		if !v.HaveTag(tagId) {
+			continue
+		}
+
+		if err := s.SearchSeries(v.Id); err != nil {
+			notSearched = append(notSearched, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+			continue
+		}
+
+		searched = append(searched, v.Title)
+	}
+
+	fmt.Printf("\nSearch queued in %v for following series (%v):\n", name, len(searched))
+	for _, v := range searched {
+		fmt.Println(v)
+	}
+
+	if len(notSearched) > 0 {
+		fmt.Printf("\nSearch not queued in %v for following series (%v):\n", name, len(notSearched))
+		for _, v := range notSearched {
+			fmt.Println(v)
+		}
+	}
+}
+
+func searchMovies(m *radarr.Client, name, tag string) {
+	tagExists, tagId, err := m.TagExists(tag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !tagExists {
+		fmt.Printf("tag %v not found in %v\n", tag, name)
+		return
+	}
+
+	movies, err := m.GetAllMovies()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ids := []int32{}
+	titles := []string{}
+	for _, v := range movies {
+		if v.HaveTag(tagId) {
+			ids = append(ids, v.Id)
+			titles = append(titles, v.Title)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	if err := m.SearchMovies(ids); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\nSearch queued in %v for following movies (%v):\n", name, len(titles))
+	for _, v := range titles {
+		fmt.Println(v)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+	"github.com/varoOP/shinkarr/internal/anime"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/database"
+	"github.com/varoOP/shinkarr/internal/maloauth"
+	"github.com/varoOP/shinkarr/internal/rules"
+	"github.com/varoOP/shinkarr/internal/season"
+	"github.com/varoOP/shinkarr/internal/state"
+)
+
+// listServer serves the MAL selection as Sonarr and Radarr custom import
+// lists.
+type listServer struct {
+	cfg    *config.Config
+	db     *database.DB
+	st     *state.DB
+	mal    *mal.Client
+	rules  *rules.Set
+	router *rules.Router
+
+	mu    sync.Mutex
+	cache map[string]cachedSeason
+	maps  cachedMaps
+}
+
+type cachedSeason struct {
+	anime   []anime.Anime
+	fetched time.Time
+}
+
+type cachedMaps struct {
+	maps    *database.Maps
+	fetched time.Time
+}
+
+// runServe serves
+//
+//	/sonarr  [{"tvdbId": 123}, ...]
+//	/radarr  [{"id": 456}, ...]
+//
+// Both take the query parameters season and year (the current season by
+// default; season may also be next or previous), status, a comma separated
+// list of MAL list statuses selected instead of watching and plan to watch,
+// and instance, which keeps only the titles routed to that instance. The
+// titles are selected like a sync selects them; specials, which a sync
+// monitors in their parent series, are left out.
+func runServe(cfg *config.Config, db *database.DB, st *state.DB) {
+	ruleSet, err := rules.NewSet(cfg.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	router, err := rules.NewRouter(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := &listServer{
+		cfg:    cfg,
+		db:     db,
+		st:     st,
+		mal:    mal.NewClient(maloauth.NewOauth2Client(db)),
+		rules:  ruleSet,
+		router: router,
+		cache:  map[string]cachedSeason{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sonarr", s.handleSonarr)
+	mux.HandleFunc("/radarr", s.handleRadarr)
+	log.Printf("serving import lists on %v", cfg.Serve.Address)
+	log.Fatal(http.ListenAndServe(cfg.Serve.Address, s.authorize(mux)))
+}
+
+func (s *listServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("apikey")
+		if key == "" {
+			key = r.Header.Get("X-Api-Key")
+		}
+
+		if s.cfg.Serve.ApiKey != "" && key != s.cfg.Serve.ApiKey {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type sonarrListItem struct {
+	TvdbId int32 `json:"tvdbId"`
+}
+
+type radarrListItem struct {
+	Id int32 `json:"id"`
+}
+
+func (s *listServer) handleSonarr(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.listIDs(r, "tvdb")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	items := []sonarrListItem{}
+	for _, id := range ids {
+		items = append(items, sonarrListItem{TvdbId: id})
+	}
+
+	writeJSON(w, items)
+}
+
+func (s *listServer) handleRadarr(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.listIDs(r, "tmdb")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	items := []radarrListItem{}
+	for _, id := range ids {
+		items = append(items, radarrListItem{Id: id})
+	}
+
+	writeJSON(w, items)
+}
+
+// requestError is a problem with the query parameters.
+type requestError struct {
+	msg string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func (s *listServer) error(w http.ResponseWriter, err error) {
+	if _, ok := err.(*requestError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Print(err)
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
+
+// listIDs returns the tvdb or tmdb ids of the titles selected for the
+// request, series for tvdb and movies for tmdb.
+func (s *listServer) listIDs(r *http.Request, dbtype string) ([]int32, error) {
+	q := r.URL.Query()
+	year := 0
+	if v := q.Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, &requestError{fmt.Sprintf("invalid year %q", v)}
+		}
+
+		year = y
+	}
+
+	name := q.Get("season")
+	if name == "" {
+		name = "current"
+		if year != 0 {
+			name, _ = season.Of(time.Now())
+		}
+	}
+
+	seasonName, year, err := season.Resolve(name, year, time.Now())
+	if err != nil {
+		return nil, &requestError{err.Error()}
+	}
+
+	statuses := map[string]bool{}
+	for _, v := range strings.Split(q.Get("status"), ",") {
+		if v != "" {
+			statuses[strings.ToLower(v)] = true
+		}
+	}
+
+	instance := q.Get("instance")
+	a, err := s.seasonalAnime(seasonName, year)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded, err := s.st.Exclusions()
+	if err != nil {
+		return nil, err
+	}
+
+	maps, err := s.mappings()
+	if err != nil {
+		return nil, err
+	}
+
+	onList := onWatchList
+	if len(statuses) > 0 {
+		onList = func(v anime.Anime) bool { return statuses[v.ListStatus] }
+	}
+
+	sel, err := selectAnime(s.cfg, s.rules, s.db, maps, excluded, a, onList)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := sel.movies
+	if dbtype == "tvdb" {
+		// Serving the parent series of a special would have Sonarr add all
+		// of it.
+		specials := findSpecials(maps, a, sel.series, sel.crossed)
+		candidates = []int32{}
+		for _, malid := range sel.series {
+			if _, ok := specials[malid]; !ok {
+				candidates = append(candidates, malid)
+			}
+		}
+	}
+
+	byID := map[int32]anime.Anime{}
+	for _, v := range a {
+		byID[v.ID] = v
+	}
+
+	malids := []int32{}
+	for _, malid := range candidates {
+		if instance != "" {
+			v := byID[malid]
+			t, err := s.router.Route(v.Env())
+			if err != nil {
+				return nil, err
+			}
+
+			if (dbtype == "tvdb" && !t.HasSonarr(instance)) || (dbtype == "tmdb" && !t.HasRadarr(instance)) {
+				continue
+			}
+		}
+
+		malids = append(malids, malid)
+	}
+
+	m, err := s.db.LookupIDs(malids, dbtype, maps)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int32{}
+	seen := map[int32]bool{}
+	for _, malid := range malids {
+		if id, ok := m[malid]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// seasonalAnime returns the titles of the season, fetching them from MAL
+// at most once every CacheMinutes.
+func (s *listServer) seasonalAnime(seasonName string, year int) ([]anime.Anime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := season.Key(seasonName, year)
+	if c, ok := s.cache[key]; ok && time.Since(c.fetched) < time.Duration(s.cfg.Serve.CacheMinutes)*time.Minute {
+		return c.anime, nil
+	}
+
+	a, complete, err := seasonalAnime(s.mal, seasonName, year, s.cfg.MAL.NSFW)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("fetched %v titles of %v from MAL", len(a), key)
+	// An incomplete season is served but fetched again on the next request.
+	if complete {
+		s.cache[key] = cachedSeason{anime: a, fetched: time.Now()}
+	}
+
+	return a, nil
+}
+
+// mappings returns the community mappings, downloading them at most once
+// every CacheMinutes.
+func (s *listServer) mappings() (*database.Maps, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maps.maps != nil && time.Since(s.maps.fetched) < time.Duration(s.cfg.Serve.CacheMinutes)*time.Minute {
+		return s.maps.maps, nil
+	}
+
+	maps, err := database.LoadMaps()
+	if err != nil {
+		return nil, err
+	}
+
+	s.maps = cachedMaps{maps: maps, fetched: time.Now()}
+	return maps, nil
+}
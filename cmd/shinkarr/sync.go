@@ -0,0 +1,1201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nstratos/go-myanimelist/mal"
+	"github.com/varoOP/shinkarr/internal/anime"
+	"github.com/varoOP/shinkarr/internal/autobrr"
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/database"
+	"github.com/varoOP/shinkarr/internal/maloauth"
+	"github.com/varoOP/shinkarr/internal/rules"
+	"github.com/varoOP/shinkarr/internal/season"
+	"github.com/varoOP/shinkarr/internal/sonarr"
+	"github.com/varoOP/shinkarr/internal/state"
+)
+
+// runSync syncs the seasons in order, given by their keys like spring-2024.
+func runSync(cfg *config.Config, db *database.DB, st *state.DB, seasons []string, includeDeleted bool) {
+	s, err := newSyncer(cfg, db, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.includeDeleted = includeDeleted
+	for _, key := range seasons {
+		name, year, err := season.ParseKey(key)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(seasons) > 1 {
+			fmt.Printf("\nSyncing %v\n", key)
+		}
+
+		if err := s.run(name, year); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// syncer holds the clients of a sync so the daemon can reuse them between
+// runs. The instances, with the tags, quality profiles and root folders
+// looked up for them, are set up again by every run.
+type syncer struct {
+	cfg     *config.Config
+	db      *database.DB
+	st      *state.DB
+	mal     *mal.Client
+	rules   *rules.Set
+	router  *rules.Router
+	sonarrs []*sonarrInstance
+	radarrs []*radarrInstance
+	// includeDeleted adds titles again that were deleted from an instance
+	// after shinkarr added them.
+	includeDeleted bool
+}
+
+func newSyncer(cfg *config.Config, db *database.DB, st *state.DB) (*syncer, error) {
+	oc, err := maloauth.NewClient(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleSet, err := rules.NewSet(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := rules.NewRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncer{
+		cfg:    cfg,
+		db:     db,
+		st:     st,
+		mal:    mal.NewClient(oc),
+		rules:  ruleSet,
+		router: router,
+	}, nil
+}
+
+// connect sets up the instances for a run, so tags, quality profiles and
+// root folders changed in Sonarr or Radarr since the last run are picked up.
+func (sy *syncer) connect() error {
+	sonarrs, radarrs, err := connectInstances(sy.cfg, sy.router)
+	if err != nil {
+		return err
+	}
+
+	sy.sonarrs, sy.radarrs = sonarrs, radarrs
+	return nil
+}
+
+// run adds the selected titles of a season to the instances.
+func (sy *syncer) run(season string, seasonYear int) error {
+	if err := sy.connect(); err != nil {
+		return err
+	}
+
+	maps, err := database.LoadMaps()
+	if err != nil {
+		return fmt.Errorf("loading the community mapping: %w", err)
+	}
+
+	cfg, db, st, c, ruleSet, router := sy.cfg, sy.db, sy.st, sy.mal, sy.rules, sy.router
+	a, complete, err := seasonalAnime(c, season, seasonYear, cfg.MAL.NSFW)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("fetched %v titles of %v %v from MAL", len(a), season, seasonYear)
+
+	username := ""
+	if strings.Contains(cfg.Tags.Template, "{username}") {
+		u, _, err := c.User.MyInfo(context.Background())
+		if err != nil {
+			return err
+		}
+
+		username = u.Name
+	}
+
+	targets := map[int32]rules.Targets{}
+	for _, v := range a {
+		t, err := router.Route(v.Env())
+		if err != nil {
+			return err
+		}
+
+		targets[v.ID] = t
+	}
+
+	excluded, err := st.Exclusions()
+	if err != nil {
+		return err
+	}
+
+	sonarrExcluded, radarrExcluded, err := sy.exclusions()
+	if err != nil {
+		return err
+	}
+
+	sel, err := selectAnime(cfg, ruleSet, db, maps, excluded, a, onWatchList)
+	if err != nil {
+		return err
+	}
+
+	malIdsSeries, malIdsMovies, crossed := sel.series, sel.movies, sel.crossed
+	searchNow := map[int32]bool{}
+	tagLabels := map[int32][]string{}
+	for _, v := range a {
+		if !sel.selected[v.ID] {
+			continue
+		}
+
+		searchNow[v.ID] = cfg.Search.SearchNow(v.ListStatus, v.Priority)
+		tagLabels[v.ID] = append([]string{cfg.Tags.Render(map[string]string{
+			"season":     season,
+			"year":       strconv.Itoa(seasonYear),
+			"status":     v.ListStatus,
+			"media_type": v.MediaType,
+			"username":   username,
+		})}, cfg.Tags.Metadata(v.Genres, v.Studios, v.Rating, v.Source)...)
+	}
+
+	if len(sel.skipped) > 0 {
+		fmt.Printf("\nFollowing anime skipped by rules (%v):\n", len(sel.skipped))
+		for _, v := range sel.skipped {
+			fmt.Println(v)
+		}
+	}
+
+	if len(sel.skippedMedia) > 0 {
+		fmt.Printf("\nFollowing anime skipped by media type (%v):\n", len(sel.skippedMedia))
+		for _, v := range sel.skippedMedia {
+			fmt.Println(v)
+		}
+	}
+
+	if len(sel.skippedExcluded) > 0 {
+		fmt.Printf("\nFollowing anime skipped as excluded (%v):\n", len(sel.skippedExcluded))
+		for _, v := range sel.skippedExcluded {
+			fmt.Println(v)
+		}
+	}
+
+	if len(crossed) > 0 {
+		fmt.Printf("\nFollowing anime cross-routed (%v):\n", len(crossed))
+		for _, v := range a {
+			if reason, ok := crossed[v.ID]; ok {
+				fmt.Printf("%v (https://myanimelist.net/anime/%v)\nreason:%v\n\n", v.Title, v.ID, reason)
+			}
+		}
+	}
+
+	fmt.Println("Total number of anime series we wish to add: ", len(malIdsSeries))
+	fmt.Println("Total number of anime movies we wish to add: ", len(malIdsMovies))
+
+	animeTv, err := db.GetIDs(malIdsSeries, "tvdb", maps)
+	if err != nil {
+		return err
+	}
+
+	animeMovie, err := db.GetIDs(malIdsMovies, "tmdb", maps)
+	if err != nil {
+		return err
+	}
+
+	specials := findSpecials(maps, a, malIdsSeries, crossed)
+
+	statuses := map[int32]string{}
+	for _, v := range a {
+		statuses[v.ID] = v.ListStatus
+	}
+
+	added := map[int32]bool{}
+	var listed map[int32]anime.Anime
+	for _, si := range sy.sonarrs {
+		sc, s := si.cfg, si.client
+		series, err := s.GetAllSeries()
+		if err != nil {
+			return fmt.Errorf("%v: %w", sc.Path, err)
+		}
+
+		library := map[int32]bool{}
+		for _, v := range series {
+			library[v.TvdbId] = true
+		}
+
+		history, err := sy.history(sc.Path, "series", library)
+		if err != nil {
+			return err
+		}
+
+		seriesAdded := []string{}
+		seriesNotAdded := []string{}
+		seriesSkipped := []string{}
+		selected := map[int32]bool{}
+
+		for malid, v := range animeTv {
+			if !targets[malid].HasSonarr(sc.Name) {
+				continue
+			}
+
+			if _, ok := specials[malid]; ok {
+				continue
+			}
+
+			if sonarrExcluded[sc.Name][v.ID] {
+				seriesSkipped = append(seriesSkipped, fmt.Sprintf("%v\nreason:excluded in Sonarr\n", v.Title))
+				continue
+			}
+
+			skip, err := sy.skipDeleted(sc.Path, history, malid, v.ID, statuses[malid])
+			if err != nil {
+				return err
+			}
+
+			if skip {
+				seriesSkipped = append(seriesSkipped, fmt.Sprintf("%v\nreason:deleted from Sonarr after shinkarr added it\n", v.Title))
+				continue
+			}
+
+			tagIds, err := si.tags.ids(append(tagLabels[malid], sc.Tags...))
+			if err != nil {
+				return err
+			}
+
+			created, err := s.AddSeries(v.Title, v.ID, tagIds, si.options(targets[malid].SonarrOverrides, searchNow[malid]))
+			if err != nil {
+				seriesNotAdded = append(seriesNotAdded, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+				continue
+			}
+
+			// Titles that were already there aren't shinkarr's to track.
+			if created {
+				if err := sy.st.RecordAdded(sc.Path, malid, v.ID, v.Title, statuses[malid]); err != nil {
+					return err
+				}
+			}
+
+			seriesAdded = append(seriesAdded, v.Title)
+			added[malid] = true
+			selected[malid] = true
+		}
+
+		if len(seriesAdded) > 0 {
+			fmt.Printf("\nFollowing series added to %v (%v):\n", sc.Name, len(seriesAdded))
+			for _, v := range seriesAdded {
+				fmt.Println(v)
+			}
+		}
+
+		if len(seriesNotAdded) > 0 {
+			fmt.Printf("\nFollowing series not added to %v (%v):\n", sc.Name, len(seriesNotAdded))
+			for _, v := range seriesNotAdded {
+				fmt.Println(v)
+			}
+		}
+
+		if len(seriesSkipped) > 0 {
+			fmt.Printf("\nFollowing series skipped in %v (%v):\n", sc.Name, len(seriesSkipped))
+			for _, v := range seriesSkipped {
+				fmt.Println(v)
+			}
+		}
+
+		monitorSpecials(si, specials, animeTv, targets, added)
+
+		if len(sc.Lifecycle) == 0 && !sc.MonitorUnwatchedOnly {
+			continue
+		}
+
+		if listed == nil {
+			if listed, err = userList(c); err != nil {
+				return fmt.Errorf("fetching MAL list: %w", err)
+			}
+		}
+
+		// Only the series shinkarr put in the instance follow the MAL list:
+		// those of this run and those it added before. Specials aren't
+		// among them, their parent follows its own MAL entry.
+		current := []anime.Anime{}
+		for _, v := range a {
+			if selected[v.ID] {
+				current = append(current, v)
+			}
+		}
+
+		current = managed(current, history, listed)
+		if len(sc.Lifecycle) > 0 {
+			if err := applyLifecycle(db, maps, s, sc.Lifecycle, current); err != nil {
+				return err
+			}
+		}
+
+		if sc.MonitorUnwatchedOnly {
+			if err := monitorUnwatched(db, maps, s, current); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ri := range sy.radarrs {
+		rc, m := ri.cfg, ri.client
+		movies, err := m.GetAllMovies()
+		if err != nil {
+			return fmt.Errorf("%v: %w", rc.Path, err)
+		}
+
+		library := map[int32]bool{}
+		for _, v := range movies {
+			library[v.TmdbId] = true
+		}
+
+		history, err := sy.history(rc.Path, "movies", library)
+		if err != nil {
+			return err
+		}
+
+		moviesAdded := []string{}
+		moviesNotAdded := []string{}
+		moviesSkipped := []string{}
+
+		for malid, v := range animeMovie {
+			if !targets[malid].HasRadarr(rc.Name) {
+				continue
+			}
+
+			if radarrExcluded[rc.Name][v.ID] {
+				moviesSkipped = append(moviesSkipped, fmt.Sprintf("%v\nreason:excluded in Radarr\n", v.Title))
+				continue
+			}
+
+			skip, err := sy.skipDeleted(rc.Path, history, malid, v.ID, statuses[malid])
+			if err != nil {
+				return err
+			}
+
+			if skip {
+				moviesSkipped = append(moviesSkipped, fmt.Sprintf("%v\nreason:deleted from Radarr after shinkarr added it\n", v.Title))
+				continue
+			}
+
+			tagIds, err := ri.tags.ids(append(tagLabels[malid], rc.Tags...))
+			if err != nil {
+				return err
+			}
+
+			created, err := m.AddMovie(v.Title, v.ID, tagIds, ri.options(targets[malid].RadarrOverrides, searchNow[malid]))
+			if err != nil {
+				moviesNotAdded = append(moviesNotAdded, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+				continue
+			}
+
+			if created {
+				if err := sy.st.RecordAdded(rc.Path, malid, v.ID, v.Title, statuses[malid]); err != nil {
+					return err
+				}
+			}
+
+			moviesAdded = append(moviesAdded, v.Title)
+			added[malid] = true
+		}
+
+		if len(moviesAdded) > 0 {
+			fmt.Printf("\nFollowing movies added to %v (%v):\n", rc.Name, len(moviesAdded))
+			for _, v := range moviesAdded {
+				fmt.Println(v)
+			}
+		}
+
+		if len(moviesNotAdded) > 0 {
+			fmt.Printf("\nFollowing movies not added to %v (%v):\n", rc.Name, len(moviesNotAdded))
+			for _, v := range moviesNotAdded {
+				fmt.Println(v)
+			}
+		}
+
+		if len(moviesSkipped) > 0 {
+			fmt.Printf("\nFollowing movies skipped in %v (%v):\n", rc.Name, len(moviesSkipped))
+			for _, v := range moviesSkipped {
+				fmt.Println(v)
+			}
+		}
+	}
+
+	unrouted := []string{}
+	for malid, v := range animeTv {
+		if len(targets[malid].Sonarr) == 0 {
+			unrouted = append(unrouted, fmt.Sprintf("%v\nreason:%v\n", v.Title, noInstance(targets[malid], "sonarr")))
+		}
+	}
+
+	for malid, v := range animeMovie {
+		if len(targets[malid].Radarr) == 0 {
+			unrouted = append(unrouted, fmt.Sprintf("%v\nreason:%v\n", v.Title, noInstance(targets[malid], "radarr")))
+		}
+	}
+
+	if len(unrouted) > 0 {
+		fmt.Printf("\nFollowing anime have no instance to go to (%v):\n", len(unrouted))
+		for _, v := range unrouted {
+			fmt.Println(v)
+		}
+	}
+
+	if cfg.Autobrr != nil {
+		ab := autobrr.NewClient(cfg.Autobrr)
+		addedAnime := []anime.Anime{}
+		for _, v := range a {
+			if added[v.ID] {
+				addedAnime = append(addedAnime, v)
+			}
+		}
+
+		if cfg.Autobrr.FilterID != 0 {
+			updateAutobrrFilter(ab, cfg.Autobrr.FilterID, addedAnime)
+		}
+
+		if cfg.Autobrr.SeasonTemplateID != 0 {
+			if err := updateSeasonFilter(ab, st, cfg.Autobrr, season, seasonYear, addedAnime); err != nil {
+				return err
+			}
+
+			if err := maintainSeasonFilters(ab, st, cfg.Autobrr, c, statuses); err != nil {
+				return err
+			}
+		}
+	}
+
+	if complete {
+		fmt.Printf("\nMAL data complete: %v titles of %v %v considered\n", len(a), season, seasonYear)
+	} else {
+		fmt.Printf("\nMAL data incomplete: only %v titles of %v %v considered, run again to pick up the rest\n", len(a), season, seasonYear)
+	}
+
+	return nil
+}
+
+// selection is what a sync adds of a season.
+type selection struct {
+	// series and movies are the mal ids of the titles that go to Sonarr and
+	// Radarr, after crossRoute.
+	series []int32
+	movies []int32
+	// selected holds the mal ids of both.
+	selected map[int32]bool
+	// crossed is why each title crossRoute moved went where it did.
+	crossed map[int32]string
+	// skipped, skippedMedia and skippedExcluded report the titles left out
+	// by the rules, their media type and the exclusions of shinkarr.
+	skipped         []string
+	skippedMedia    []string
+	skippedExcluded []string
+}
+
+// selectAnime picks the titles of a season that a sync adds, given which of
+// them count as on the user's list. The import lists of serve use it too,
+// so both select the same titles.
+func selectAnime(cfg *config.Config, ruleSet *rules.Set, db *database.DB, maps *database.Maps, excluded map[int32]bool, a []anime.Anime, onList func(anime.Anime) bool) (*selection, error) {
+	sel := &selection{selected: map[int32]bool{}}
+	series := []int32{}
+	movies := []int32{}
+	for _, v := range a {
+		if excluded[v.ID] {
+			sel.skippedExcluded = append(sel.skippedExcluded, fmt.Sprintf("%v (https://myanimelist.net/anime/%v)\nreason:excluded in shinkarr\n", v.Title, v.ID))
+			continue
+		}
+
+		listed := onList(v)
+		d, err := ruleSet.Evaluate(v.Env(), listed)
+		if err != nil {
+			return nil, err
+		}
+
+		if !d.Selected {
+			if d.Rule != "" || listed {
+				sel.skipped = append(sel.skipped, fmt.Sprintf("%v (https://myanimelist.net/anime/%v)\nreason:%v\n", v.Title, v.ID, d.Reason))
+			}
+
+			continue
+		}
+
+		target := cfg.MAL.Target(v.MediaType)
+		if target == "skip" {
+			sel.skippedMedia = append(sel.skippedMedia, fmt.Sprintf("%v (https://myanimelist.net/anime/%v)\nmedia type:%v\n", v.Title, v.ID, v.MediaType))
+			continue
+		}
+
+		sel.selected[v.ID] = true
+		if target == "radarr" {
+			movies = append(movies, v.ID)
+			continue
+		}
+
+		series = append(series, v.ID)
+	}
+
+	var err error
+	sel.series, sel.movies, sel.crossed, err = crossRoute(db, maps, series, movies)
+	if err != nil {
+		return nil, err
+	}
+
+	return sel, nil
+}
+
+// exclusions fetches the import list exclusions of every instance, tvdb ids
+// for Sonarr and tmdb ids for Radarr, keyed by instance name.
+func (sy *syncer) exclusions() (map[string]map[int32]bool, map[string]map[int32]bool, error) {
+	sonarrExcluded := map[string]map[int32]bool{}
+	for _, si := range sy.sonarrs {
+		ids, err := si.client.GetExclusions()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %w", si.cfg.Path, err)
+		}
+
+		sonarrExcluded[si.cfg.Name] = ids
+	}
+
+	radarrExcluded := map[string]map[int32]bool{}
+	for _, ri := range sy.radarrs {
+		ids, err := ri.client.GetExclusions()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %w", ri.cfg.Path, err)
+		}
+
+		radarrExcluded[ri.cfg.Name] = ids
+	}
+
+	return sonarrExcluded, radarrExcluded, nil
+}
+
+// history returns the titles added to the instance keyed by mal id. Those
+// no longer in its library, tvdb or tmdb ids, are turned into tombstones
+// and reported. An empty library is more likely a wiped or misconfigured
+// instance than every title deleted, so nothing is marked then.
+func (sy *syncer) history(instance, kind string, library map[int32]bool) (map[int32]state.Added, error) {
+	h, err := sy.st.History(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(library) == 0 {
+		for _, v := range h {
+			if !v.Deleted {
+				fmt.Printf("\n%v has no %v but shinkarr added some to it, none are marked deleted\n", instance, kind)
+				break
+			}
+		}
+
+		return h, nil
+	}
+
+	deleted := []string{}
+	for malid, v := range h {
+		if v.Deleted || library[v.ExternalID] {
+			continue
+		}
+
+		if err := sy.st.MarkDeleted(instance, malid); err != nil {
+			return nil, err
+		}
+
+		v.Deleted = true
+		h[malid] = v
+		deleted = append(deleted, v.Title)
+	}
+
+	if len(deleted) > 0 {
+		fmt.Printf("\nFollowing %v were deleted from %v since shinkarr added them (%v):\n", kind, instance, len(deleted))
+		for _, v := range deleted {
+			fmt.Println(v)
+		}
+	}
+
+	return h, nil
+}
+
+// skipDeleted reports whether the title stays out of the instance because
+// it, or another MAL entry of the same series or movie, was deleted there.
+// It is added again with --include-deleted or once its MAL list status
+// changes to watching.
+func (sy *syncer) skipDeleted(instance string, history map[int32]state.Added, malid, externalID int32, status string) (bool, error) {
+	// The instance keys by tvdb or tmdb id, so an entry deleted with its
+	// series, like a sequel season, keeps the series out for every entry
+	// until one of them is added back.
+	h, ok := history[malid]
+	for _, v := range history {
+		if v.ExternalID != externalID {
+			continue
+		}
+
+		if !v.Deleted {
+			return false, nil
+		}
+
+		if !ok {
+			h, ok = v, true
+		}
+	}
+
+	if !ok || !h.Deleted || sy.includeDeleted {
+		return false, nil
+	}
+
+	watching := string(mal.AnimeStatusWatching)
+	if status == watching && h.ListStatus != watching {
+		return false, nil
+	}
+
+	if h.MalID == malid && status != h.ListStatus {
+		if err := sy.st.SetListStatus(instance, malid, status); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// special is a MAL entry made up of season 0 episodes of a TVDB series.
+type special struct {
+	start int32
+	count int32
+}
+
+// crossRoute moves movies that have no tmdb id but a tvdb id to the series,
+// where they become specials, and series that have no tvdb id but a tmdb id
+// to the movies. It returns the new lists and why each moved title moved,
+// keyed by mal id.
+func crossRoute(db *database.DB, maps *database.Maps, series, movies []int32) ([]int32, []int32, map[int32]string, error) {
+	crossed := map[int32]string{}
+	toSeries, err := crossIDs(db, maps, movies, "tmdb", "tvdb")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	toMovies, err := crossIDs(db, maps, series, "tvdb", "tmdb")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	newSeries := []int32{}
+	newMovies := []int32{}
+	for _, malid := range series {
+		if toMovies[malid] {
+			newMovies = append(newMovies, malid)
+			crossed[malid] = "no tvdb id but listed as a film on TMDB, sent to Radarr"
+			continue
+		}
+
+		newSeries = append(newSeries, malid)
+	}
+
+	for _, malid := range movies {
+		if toSeries[malid] {
+			newSeries = append(newSeries, malid)
+			crossed[malid] = "film without a tmdb id but on TVDB, sent to Sonarr as a special"
+			continue
+		}
+
+		newMovies = append(newMovies, malid)
+	}
+
+	return newSeries, newMovies, crossed, nil
+}
+
+// crossIDs returns the malids that have no id of dbtype but one of other.
+func crossIDs(db *database.DB, maps *database.Maps, malids []int32, dbtype, other string) (map[int32]bool, error) {
+	ids, err := db.LookupIDs(malids, dbtype, maps)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []int32{}
+	for _, malid := range malids {
+		if _, ok := ids[malid]; !ok {
+			missing = append(missing, malid)
+		}
+	}
+
+	found := map[int32]bool{}
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	otherIDs, err := db.LookupIDs(missing, other, maps)
+	if err != nil {
+		return nil, err
+	}
+
+	for malid := range otherIDs {
+		found[malid] = true
+	}
+
+	return found, nil
+}
+
+// findSpecials returns the titles of series, mal ids, whose mapping points
+// at season 0, keyed by mal id. Films crossRoute sent to Sonarr, the only
+// crossed titles in series, are specials even without a mapping; their
+// episode is then unknown and start is 0.
+func findSpecials(maps *database.Maps, a []anime.Anime, series []int32, crossed map[int32]string) map[int32]special {
+	ids := map[int32]bool{}
+	for _, malid := range series {
+		ids[malid] = true
+	}
+
+	specials := map[int32]special{}
+	for _, v := range a {
+		if !ids[v.ID] {
+			continue
+		}
+
+		m := maps.TVDB.Find(int(v.ID))
+		if m == nil || !m.IsSpecial() {
+			if _, ok := crossed[v.ID]; ok {
+				specials[v.ID] = special{}
+			}
+
+			continue
+		}
+
+		sp := special{start: int32(m.Seasons()[0].Start), count: int32(v.NumEpisodes)}
+		if sp.start <= 0 {
+			sp.start = 1
+		}
+
+		// MAL leaves the episode count at 0 until it is known.
+		if sp.count <= 0 {
+			sp.count = 1
+		}
+
+		specials[v.ID] = sp
+	}
+
+	return specials
+}
+
+// monitorSpecials monitors the episodes of the specials routed to the
+// instance in their parent series instead of adding them as series. A
+// parent series missing from the instance is reported, not added.
+func monitorSpecials(si *sonarrInstance, specials map[int32]special, ids map[int32]database.Match, targets map[int32]rules.Targets, added map[int32]bool) {
+	monitored := []string{}
+	notMonitored := []string{}
+	parents := []string{}
+	for malid, sp := range specials {
+		if !targets[malid].HasSonarr(si.cfg.Name) {
+			continue
+		}
+
+		v, ok := ids[malid]
+		if !ok {
+			continue
+		}
+
+		if sp.start == 0 {
+			notMonitored = append(notMonitored, fmt.Sprintf("%v\nerror:no season 0 episode mapped on TVDB, add it to shinkro-mapping\n", v.Title))
+			continue
+		}
+
+		n, err := si.client.MonitorSpecials(v.ID, sp.start, sp.count)
+		if errors.Is(err, sonarr.ErrSeriesNotFound) {
+			// Specials never add a series; the user decides whether the
+			// parent belongs in Sonarr.
+			parents = append(parents, fmt.Sprintf("%v\nreason:parent series tvdb id %v not in Sonarr, add it to get the specials\n", v.Title, v.ID))
+			continue
+		}
+
+		if err != nil {
+			notMonitored = append(notMonitored, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+			continue
+		}
+
+		if n < 0 {
+			notMonitored = append(notMonitored, fmt.Sprintf("%v\nerror:episodes not yet available in Sonarr, retry on the next run\n", v.Title))
+			continue
+		}
+
+		episodes := fmt.Sprintf("S00E%02d", sp.start)
+		if sp.count > 1 {
+			episodes += fmt.Sprintf("-E%02d", sp.start+sp.count-1)
+		}
+
+		monitored = append(monitored, fmt.Sprintf("%v (%v)", v.Title, episodes))
+		added[malid] = true
+	}
+
+	if len(parents) > 0 {
+		fmt.Printf("\nFollowing specials have no parent series in %v (%v):\n", si.cfg.Name, len(parents))
+		for _, v := range parents {
+			fmt.Println(v)
+		}
+	}
+
+	if len(monitored) > 0 {
+		fmt.Printf("\nFollowing specials monitored in %v (%v):\n", si.cfg.Name, len(monitored))
+		for _, v := range monitored {
+			fmt.Println(v)
+		}
+	}
+
+	if len(notMonitored) > 0 {
+		fmt.Printf("\nFollowing specials not monitored in %v (%v):\n", si.cfg.Name, len(notMonitored))
+		for _, v := range notMonitored {
+			fmt.Println(v)
+		}
+	}
+}
+
+// seasonalPageSize is the largest page MAL returns for a season.
+const seasonalPageSize = 500
+
+// seasonalAnime fetches the titles of a MAL season together with the state
+// of the user's list entries, following the pages of the season until MAL
+// has no more. complete is false when a page after the first failed; the
+// titles fetched until then are returned.
+func seasonalAnime(c *mal.Client, season string, seasonYear int, nsfw bool) ([]anime.Anime, bool, error) {
+	list := []mal.Anime{}
+	complete := false
+	seen := map[int]bool{}
+	offset := 0
+	for {
+		res, resp, err := c.Anime.Seasonal(
+			context.Background(),
+			seasonYear,
+			mal.AnimeSeason(season),
+			anime.Fields,
+			mal.NSFW(nsfw),
+			mal.Limit(seasonalPageSize),
+			mal.Offset(offset),
+			mal.SortSeasonalByAnimeNumListUsers,
+		)
+		if err != nil {
+			if offset == 0 {
+				return nil, false, err
+			}
+
+			log.Printf("fetching %v %v from MAL stopped at offset %v: %v", season, seasonYear, offset, err)
+			break
+		}
+
+		// Titles can move between pages while paging since they are
+		// sorted by members.
+		for _, v := range res {
+			if !seen[v.ID] {
+				seen[v.ID] = true
+				list = append(list, v)
+			}
+		}
+
+		if resp.NextOffset == 0 || len(res) == 0 {
+			complete = true
+			break
+		}
+
+		offset = resp.NextOffset
+	}
+
+	return anime.FromMALList(list), complete, nil
+}
+
+// userList returns the titles on the user's MAL list keyed by mal id.
+func userList(c *mal.Client) (map[int32]anime.Anime, error) {
+	list := map[int32]anime.Anime{}
+	offset := 0
+	for {
+		res, resp, err := c.User.AnimeList(context.Background(), "@me", anime.Fields, mal.Limit(1000), mal.Offset(offset))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range res {
+			a := anime.FromMAL(v.Anime)
+			a.ListStatus = string(v.Status.Status)
+			a.EpisodesWatched = v.Status.NumEpisodesWatched
+			list[a.ID] = a
+		}
+
+		if resp.NextOffset == 0 || len(res) == 0 {
+			break
+		}
+
+		offset = resp.NextOffset
+	}
+
+	return list, nil
+}
+
+// managed returns the titles of this run followed by the others shinkarr
+// added to the instance that are still there, so list status changes reach
+// every series it manages and not only this season's.
+func managed(current []anime.Anime, history map[int32]state.Added, listed map[int32]anime.Anime) []anime.Anime {
+	seen := map[int32]bool{}
+	for _, v := range current {
+		seen[v.ID] = true
+	}
+
+	malIds := []int32{}
+	for malid, h := range history {
+		if _, ok := listed[malid]; ok && !h.Deleted && !seen[malid] {
+			malIds = append(malIds, malid)
+		}
+	}
+
+	sort.Slice(malIds, func(i, j int) bool { return malIds[i] < malIds[j] })
+	a := append([]anime.Anime{}, current...)
+	for _, malid := range malIds {
+		a = append(a, listed[malid])
+	}
+
+	return a
+}
+
+// noInstance explains why a title has no app instance, sonarr or radarr,
+// to go to.
+func noInstance(t rules.Targets, app string) string {
+	if t.Route != "" {
+		return fmt.Sprintf("route %q has no %v instance", t.Route, app)
+	}
+
+	return fmt.Sprintf("matched no route and there is no default %v instance", app)
+}
+
+// onWatchList reports whether the title is selected when no rule says
+// otherwise.
+func onWatchList(v anime.Anime) bool {
+	return v.ListStatus == string(mal.AnimeStatusPlanToWatch) || v.ListStatus == string(mal.AnimeStatusWatching)
+}
+
+// connectInstances sets up every configured instance and checks the config
+// and the route overrides against it before anything is processed. All
+// problems found are reported at once.
+func connectInstances(cfg *config.Config, router *rules.Router) ([]*sonarrInstance, []*radarrInstance, error) {
+	problems := []string{}
+	sonarrs := []*sonarrInstance{}
+	byName := map[string]*sonarrInstance{}
+	for _, sc := range cfg.Sonarr {
+		si, p := newSonarrInstance(sc)
+		problems = append(problems, p...)
+		if si == nil {
+			continue
+		}
+
+		sonarrs = append(sonarrs, si)
+		byName[sc.Name] = si
+	}
+
+	radarrs := []*radarrInstance{}
+	radarrByName := map[string]*radarrInstance{}
+	for _, rc := range cfg.Radarr {
+		ri, p := newRadarrInstance(rc)
+		problems = append(problems, p...)
+		if ri == nil {
+			continue
+		}
+
+		radarrs = append(radarrs, ri)
+		radarrByName[rc.Name] = ri
+	}
+
+	for _, route := range router.Routes() {
+		for _, name := range route.Sonarr {
+			if si, ok := byName[name]; ok {
+				if err := si.check(route.SonarrOverrides); err != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v", route.Name, err))
+				}
+			}
+		}
+
+		for _, name := range route.Radarr {
+			if ri, ok := radarrByName[name]; ok {
+				if err := ri.check(route.RadarrOverrides); err != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v", route.Name, err))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("preflight checks failed:\n%v", strings.Join(problems, "\n"))
+	}
+
+	return sonarrs, radarrs, nil
+}
+
+// mappedSeasons lays the MAL entry out on TVDB seasons. An entry within a
+// single season ends after its episode count, so sequels sharing the season
+// aren't touched.
+func mappedSeasons(m *database.Anime, numEpisodes int) []sonarr.SeasonStart {
+	seasons := []sonarr.SeasonStart{}
+	for _, ms := range m.Seasons() {
+		seasons = append(seasons, sonarr.SeasonStart{SeasonNumber: int32(ms.TvdbSeason), Start: int32(ms.Start)})
+	}
+
+	if len(seasons) == 1 && numEpisodes > 0 {
+		start := seasons[0].Start
+		if start <= 0 {
+			start = 1
+		}
+
+		seasons[0].End = start + int32(numEpisodes) - 1
+	}
+
+	return seasons
+}
+
+// applyLifecycle applies the rule for each title's list status to the TVDB
+// seasons it maps to. Titles sharing a series take the series-wide settings,
+// quality profile and root folder, from the latest season among them.
+func applyLifecycle(db *database.DB, maps *database.Maps, s *sonarr.Client, lifecycle map[string]config.LifecycleRule, a []anime.Anime) error {
+	malIds := []int32{}
+	for _, v := range a {
+		if _, ok := lifecycle[v.ListStatus]; ok {
+			malIds = append(malIds, v.ID)
+		}
+	}
+
+	if len(malIds) == 0 {
+		return nil
+	}
+
+	ids, err := db.LookupIDs(malIds, "tvdb", maps)
+	if err != nil {
+		return err
+	}
+
+	seriesUpdated := []string{}
+	seriesNotUpdated := []string{}
+	seasons := map[int32][]sonarr.SeasonStart{}
+	latest := map[int32]sonarr.SeasonStart{}
+	owner := map[int32]int32{}
+	for _, v := range a {
+		tvdbid, ok := ids[v.ID]
+		if _, rule := lifecycle[v.ListStatus]; !ok || !rule {
+			continue
+		}
+
+		m := maps.TVDB.Find(int(v.ID))
+		if m == nil {
+			seriesNotUpdated = append(seriesNotUpdated, fmt.Sprintf("%v\nerror:no TVDB season mapping\n", v.Title))
+			continue
+		}
+
+		seasons[v.ID] = mappedSeasons(m, v.NumEpisodes)
+		first := seasons[v.ID][0]
+		l, seen := latest[tvdbid]
+		if !seen || first.SeasonNumber > l.SeasonNumber || (first.SeasonNumber == l.SeasonNumber && first.Start > l.Start) {
+			latest[tvdbid] = first
+			owner[tvdbid] = v.ID
+		}
+	}
+
+	for _, v := range a {
+		ms, ok := seasons[v.ID]
+		if !ok {
+			continue
+		}
+
+		tvdbid := ids[v.ID]
+		exists, changed, err := s.ApplyLifecycle(tvdbid, ms, lifecycle[v.ListStatus], owner[tvdbid] == v.ID)
+		if err != nil {
+			seriesNotUpdated = append(seriesNotUpdated, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+			continue
+		}
+
+		if exists && changed {
+			seriesUpdated = append(seriesUpdated, fmt.Sprintf("%v (%v)", v.Title, v.ListStatus))
+		}
+	}
+
+	if len(seriesUpdated) > 0 {
+		fmt.Printf("\nFollowing series updated to match MAL status (%v):\n", len(seriesUpdated))
+		for _, v := range seriesUpdated {
+			fmt.Println(v)
+		}
+	}
+
+	if len(seriesNotUpdated) > 0 {
+		fmt.Printf("\nFollowing series not updated (%v):\n", len(seriesNotUpdated))
+		for _, v := range seriesNotUpdated {
+			fmt.Println(v)
+		}
+	}
+
+	return nil
+}
+
+func monitorUnwatched(db *database.DB, maps *database.Maps, s *sonarr.Client, a []anime.Anime) error {
+	malIds := []int32{}
+	for _, v := range a {
+		if v.ListStatus == string(mal.AnimeStatusWatching) && v.EpisodesWatched > 0 {
+			malIds = append(malIds, v.ID)
+		}
+	}
+
+	if len(malIds) == 0 {
+		return nil
+	}
+
+	ids, err := db.LookupIDs(malIds, "tvdb", maps)
+	if err != nil {
+		return err
+	}
+
+	seriesUpdated := []string{}
+	seriesNotUpdated := []string{}
+	for _, v := range a {
+		tvdbid, ok := ids[v.ID]
+		if !ok || v.ListStatus != string(mal.AnimeStatusWatching) {
+			continue
+		}
+
+		m := maps.TVDB.Find(int(v.ID))
+		if m == nil {
+			seriesNotUpdated = append(seriesNotUpdated, fmt.Sprintf("%v\nerror:no TVDB season mapping\n", v.Title))
+			continue
+		}
+
+		n, err := s.MonitorUnwatched(tvdbid, mappedSeasons(m, v.NumEpisodes), v.EpisodesWatched)
+		if err != nil {
+			seriesNotUpdated = append(seriesNotUpdated, fmt.Sprintf("%v\nerror:%v\n", v.Title, err))
+			continue
+		}
+
+		if n < 0 {
+			seriesNotUpdated = append(seriesNotUpdated, fmt.Sprintf("%v\nerror:episodes not yet available in Sonarr, retry on the next run\n", v.Title))
+			continue
+		}
+
+		if n > 0 {
+			seriesUpdated = append(seriesUpdated, fmt.Sprintf("%v (watched %v)", v.Title, v.EpisodesWatched))
+		}
+	}
+
+	if len(seriesUpdated) > 0 {
+		fmt.Printf("\nFollowing series now monitor only unwatched episodes (%v):\n", len(seriesUpdated))
+		for _, v := range seriesUpdated {
+			fmt.Println(v)
+		}
+	}
+
+	if len(seriesNotUpdated) > 0 {
+		fmt.Printf("\nFollowing series episodes not updated (%v):\n", len(seriesNotUpdated))
+		for _, v := range seriesNotUpdated {
+			fmt.Println(v)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "github.com/varoOP/shinkarr/internal/config"
+
+type tagClient interface {
+	GetTagMap() (map[string]int32, error)
+	AddTag(label string) (int32, error)
+}
+
+// tagger resolves tag labels to ids, creating the tags that don't exist yet.
+// The tag list is fetched once per run.
+type tagger struct {
+	client tagClient
+	known  map[string]int32
+}
+
+func newTagger(c tagClient) *tagger {
+	return &tagger{
+		client: c,
+	}
+}
+
+// ids returns the ids of the labels, normalised with config.TagLabel so
+// static tags from the config end up like the rendered ones.
+func (t *tagger) ids(labels []string) ([]int32, error) {
+	if t.known == nil {
+		known, err := t.client.GetTagMap()
+		if err != nil {
+			return nil, err
+		}
+
+		t.known = known
+	}
+
+	ids := []int32{}
+	seen := map[string]bool{}
+	for _, label := range labels {
+		label = config.TagLabel(label)
+		if label == "" || seen[label] {
+			continue
+		}
+
+		seen[label] = true
+		id, ok := t.known[label]
+		if !ok {
+			tagId, err := t.client.AddTag(label)
+			if err != nil {
+				return nil, err
+			}
+
+			t.known[label] = tagId
+			id = tagId
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlEdit sets key of a table to value, or removes it when remove is set.
+type tomlEdit struct {
+	key    string
+	value  interface{}
+	remove bool
+}
+
+// editTOML applies the edits to the keys of table, a dotted name like sonarr
+// or sonarr.hd, in doc. Only the lines of those keys change; comments,
+// order and everything else is kept as it is. Keys the table doesn't have
+// are added after its last key, and the table is appended if it is missing.
+func editTOML(doc []byte, table string, edits []tomlEdit) ([]byte, error) {
+	lines := strings.SplitAfter(string(doc), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	start := -1
+	for i, l := range lines {
+		if name, ok := tableName(l); ok && name == table {
+			start = i
+			break
+		}
+	}
+
+	if start < 0 {
+		if len(lines) > 0 {
+			if !strings.HasSuffix(lines[len(lines)-1], "\n") {
+				lines[len(lines)-1] += "\n"
+			}
+
+			lines = append(lines, "\n")
+		}
+
+		lines = append(lines, "["+table+"]\n")
+		start = len(lines) - 1
+	}
+
+	for _, e := range edits {
+		last := start
+		found := -1
+		for i := start + 1; i < len(lines); i++ {
+			if _, ok := tableName(lines[i]); ok {
+				break
+			}
+
+			key, _, ok := keyLine(lines[i])
+			if !ok {
+				continue
+			}
+
+			last = i
+			if strings.EqualFold(key, e.key) {
+				found = i
+			}
+		}
+
+		if e.remove {
+			if found >= 0 {
+				lines = append(lines[:found], lines[found+1:]...)
+			}
+
+			continue
+		}
+
+		v, err := tomlValue(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", table, e.key, err)
+		}
+
+		if found >= 0 {
+			key, comment, _ := keyLine(lines[found])
+			indent := lines[found][:len(lines[found])-len(strings.TrimLeft(lines[found], " \t"))]
+			lines[found] = indent + key + " = " + v + comment + "\n"
+			continue
+		}
+
+		l := e.key + " = " + v + "\n"
+		if last == len(lines)-1 && !strings.HasSuffix(lines[last], "\n") {
+			lines[last] += "\n"
+		}
+
+		lines = append(lines[:last+1], append([]string{l}, lines[last+1:]...)...)
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// tableName returns the name of the table a [table] header line opens.
+func tableName(line string) (string, bool) {
+	l := strings.TrimSpace(line)
+	if !strings.HasPrefix(l, "[") {
+		return "", false
+	}
+
+	l = strings.TrimPrefix(strings.TrimPrefix(l, "["), "[")
+	end := strings.Index(l, "]")
+	if end < 0 {
+		return "", false
+	}
+
+	parts := strings.Split(l[:end], ".")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	return strings.Join(parts, "."), true
+}
+
+// keyLine splits a key = value line into the key and the comment after the
+// value, including the whitespace before it.
+func keyLine(line string) (string, string, bool) {
+	l := strings.TrimRight(line, "\r\n")
+	t := strings.TrimSpace(l)
+	if t == "" || strings.HasPrefix(t, "#") {
+		return "", "", false
+	}
+
+	eq := strings.Index(l, "=")
+	if eq < 0 {
+		return "", "", false
+	}
+
+	key := strings.TrimSpace(l[:eq])
+	rest := l[eq+1:]
+	i := len(rest) - len(strings.TrimLeft(rest, " \t"))
+	switch {
+	case strings.HasPrefix(rest[i:], `"`):
+		for i++; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' {
+				i++
+			}
+		}
+
+		i++
+	case strings.HasPrefix(rest[i:], "'"):
+		if n := strings.Index(rest[i+1:], "'"); n >= 0 {
+			i += n + 2
+		}
+	}
+
+	comment := ""
+	if i < len(rest) {
+		if n := strings.Index(rest[i:], "#"); n >= 0 {
+			c := rest[:i+n]
+			comment = c[len(strings.TrimRight(c, " \t")):] + rest[i+n:]
+		}
+	}
+
+	return key, comment, true
+}
+
+// tomlValue formats v as a TOML value.
+func tomlValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		b := strings.Builder{}
+		b.WriteByte('"')
+		for _, r := range v {
+			switch {
+			case r == '"' || r == '\\':
+				b.WriteByte('\\')
+				b.WriteRune(r)
+			case r < 0x20 || r == 0x7f:
+				fmt.Fprintf(&b, `\u%04X`, r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+
+		b.WriteByte('"')
+		return b.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+
+	return "", fmt.Errorf("cannot write %T", v)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/varoOP/shinkarr/internal/config"
+	"github.com/varoOP/shinkarr/internal/radarr"
+	"github.com/varoOP/shinkarr/internal/sonarr"
+)
+
+// loadConfig reads the config and exits listing every problem with it.
+func loadConfig(configPath string) *config.Config {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if p := validateConfig(cfg); len(p) > 0 {
+		log.Fatal(p)
+	}
+
+	return cfg
+}
+
+// runConfigShow prints the config as it is after the environment has been
+// applied, then the problems with it.
+func runConfigShow(configPath string, redact bool) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b, err := cfg.Marshal(redact)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(string(b))
+	if p := validateConfig(cfg); len(p) > 0 {
+		log.Fatal(p)
+	}
+}
+
+// validateConfig adds the values the Sonarr and Radarr APIs would reject to
+// the problems found while loading cfg.
+func validateConfig(cfg *config.Config) config.Problems {
+	p := append(config.Problems{}, cfg.Problems()...)
+	for _, s := range cfg.Sonarr {
+		if !sonarr.ValidMonitorType(s.MonitorType) {
+			p = append(p, config.Problem{Path: s.Path + ".MonitorType", Message: fmt.Sprintf("must be one of %v, got %q", sonarr.MonitorTypeValues, s.MonitorType)})
+		}
+
+		if !sonarr.ValidSeriesType(s.SeriesType) {
+			p = append(p, config.Problem{Path: s.Path + ".SeriesType", Message: fmt.Sprintf("must be one of %v, got %q", sonarr.SeriesTypeValues, s.SeriesType)})
+		}
+	}
+
+	for _, r := range cfg.Radarr {
+		if !radarr.ValidMonitorType(r.MonitorType) {
+			p = append(p, config.Problem{Path: r.Path + ".MonitorType", Message: fmt.Sprintf("must be one of %v, got %q", radarr.MonitorTypeValues, r.MonitorType)})
+		}
+
+		if !radarr.ValidMinimumAvailability(r.MinimumAvailability) {
+			p = append(p, config.Problem{Path: r.Path + ".MinimumAvailability", Message: fmt.Sprintf("must be one of %v, got %q", radarr.MinimumAvailabilityValues, r.MinimumAvailability)})
+		}
+	}
+
+	for i, r := range cfg.Routes {
+		if t := r.SonarrOverrides.SeriesType; t != "" && !sonarr.ValidSeriesType(t) {
+			p = append(p, config.Problem{Path: fmt.Sprintf("routes[%v].SonarrOverrides.SeriesType", i), Message: fmt.Sprintf("must be one of %v, got %q", sonarr.SeriesTypeValues, t)})
+		}
+
+		if m := r.RadarrOverrides.MinimumAvailability; m != "" && !radarr.ValidMinimumAvailability(m) {
+			p = append(p, config.Problem{Path: fmt.Sprintf("routes[%v].RadarrOverrides.MinimumAvailability", i), Message: fmt.Sprintf("must be one of %v, got %q", radarr.MinimumAvailabilityValues, m)})
+		}
+	}
+
+	return p
+}
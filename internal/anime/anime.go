@@ -0,0 +1,153 @@
+package anime
+
+import (
+	"github.com/nstratos/go-myanimelist/mal"
+)
+
+// Fields are the MAL fields requested for every seasonal title.
+var Fields = mal.Fields{
+	"alternative_titles{en,synonyms}",
+	"my_list_status{status,num_episodes_watched,priority}",
+	"media_type",
+	"status",
+	"mean",
+	"rank",
+	"popularity",
+	"num_list_users",
+	"num_scoring_users",
+	"num_episodes",
+	"start_season",
+	"nsfw",
+	"genres",
+	"studios",
+	"rating",
+	"source",
+}
+
+// Anime is a MAL title together with the state of the user's list entry.
+type Anime struct {
+	ID              int32
+	Title           string
+	EnglishTitle    string
+	Synonyms        []string
+	MediaType       string
+	Status          string
+	Mean            float64
+	Rank            int
+	Popularity      int
+	NumListUsers    int
+	NumScoringUsers int
+	NumEpisodes     int
+	StartYear       int
+	StartSeason     string
+	NSFW            string
+	Genres          []string
+	Studios         []string
+	Rating          string
+	Source          string
+
+	ListStatus      string
+	Priority        int
+	EpisodesWatched int
+}
+
+func FromMAL(a mal.Anime) Anime {
+	genres := []string{}
+	for _, v := range a.Genres {
+		genres = append(genres, v.Name)
+	}
+
+	studios := []string{}
+	for _, v := range a.Studios {
+		studios = append(studios, v.Name)
+	}
+
+	return Anime{
+		ID:              int32(a.ID),
+		Title:           a.Title,
+		EnglishTitle:    a.AlternativeTitles.En,
+		Synonyms:        a.AlternativeTitles.Synonyms,
+		MediaType:       a.MediaType,
+		Status:          a.Status,
+		Mean:            a.Mean,
+		Rank:            a.Rank,
+		Popularity:      a.Popularity,
+		NumListUsers:    a.NumListUsers,
+		NumScoringUsers: a.NumScoringUsers,
+		NumEpisodes:     a.NumEpisodes,
+		StartYear:       a.StartSeason.Year,
+		StartSeason:     a.StartSeason.Season,
+		NSFW:            a.NSFW,
+		Genres:          genres,
+		Studios:         studios,
+		Rating:          a.Rating,
+		Source:          a.Source,
+		ListStatus:      string(a.MyListStatus.Status),
+		Priority:        a.MyListStatus.Priority,
+		EpisodesWatched: a.MyListStatus.NumEpisodesWatched,
+	}
+}
+
+func FromMALList(a []mal.Anime) []Anime {
+	list := []Anime{}
+	for _, v := range a {
+		list = append(list, FromMAL(v))
+	}
+
+	return list
+}
+
+// Titles returns the MAL title followed by the English title and the
+// synonyms, without duplicates.
+func (a *Anime) Titles() []string {
+	titles := []string{}
+	seen := map[string]bool{}
+	for _, v := range append([]string{a.Title, a.EnglishTitle}, a.Synonyms...) {
+		if v == "" || seen[v] {
+			continue
+		}
+
+		seen[v] = true
+		titles = append(titles, v)
+	}
+
+	return titles
+}
+
+// Env exposes the title to rule expressions. Keys are the MAL API field
+// names where there is one.
+func (a *Anime) Env() map[string]any {
+	return map[string]any{
+		"id":                float64(a.ID),
+		"title":             a.Title,
+		"title_en":          a.EnglishTitle,
+		"synonyms":          stringList(a.Synonyms),
+		"media_type":        a.MediaType,
+		"status":            a.Status,
+		"mean":              a.Mean,
+		"rank":              float64(a.Rank),
+		"popularity":        float64(a.Popularity),
+		"num_list_users":    float64(a.NumListUsers),
+		"num_scoring_users": float64(a.NumScoringUsers),
+		"num_episodes":      float64(a.NumEpisodes),
+		"year":              float64(a.StartYear),
+		"season":            a.StartSeason,
+		"nsfw":              a.NSFW,
+		"genres":            stringList(a.Genres),
+		"studios":           stringList(a.Studios),
+		"rating":            a.Rating,
+		"source":            a.Source,
+		"list_status":       a.ListStatus,
+		"priority":          float64(a.Priority),
+		"episodes_watched":  float64(a.EpisodesWatched),
+	}
+}
+
+func stringList(s []string) []any {
+	l := []any{}
+	for _, v := range s {
+		l = append(l, v)
+	}
+
+	return l
+}
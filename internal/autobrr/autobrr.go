@@ -0,0 +1,179 @@
+package autobrr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/varoOP/shinkarr/internal/config"
+)
+
+type Client struct {
+	client *http.Client
+	config *config.AutobrrConfig
+}
+
+func NewClient(cfg *config.AutobrrConfig) *Client {
+	c := &http.Client{
+		Transport: &config.ApiKeyTransport{
+			Transport: cfg.RoundTripper(),
+			Header:    "X-API-Token",
+			ApiKey:    cfg.ApiKey,
+		},
+		Timeout: config.RequestTimeout,
+	}
+
+	return &Client{
+		config: cfg,
+		client: c,
+	}
+}
+
+// Filter holds the fields of an autobrr filter shinkarr works with.
+type Filter struct {
+	Id      int32  `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Shows   string `json:"shows"`
+}
+
+// FilterUpdate is a partial update of a filter; nil fields are left as they
+// are.
+type FilterUpdate struct {
+	Name    *string `json:"name,omitempty"`
+	Enabled *bool   `json:"enabled,omitempty"`
+	Shows   *string `json:"shows,omitempty"`
+}
+
+func (c *Client) GetFilter(id int32) (*Filter, error) {
+	f := &Filter{}
+	data, err := c.SendRequest(http.MethodGet, c.config.Url.JoinPath(fmt.Sprintf("/api/filters/%v", id)).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (c *Client) UpdateFilter(id int32, u FilterUpdate) error {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.SendRequest(http.MethodPatch, c.config.Url.JoinPath(fmt.Sprintf("/api/filters/%v", id)).String(), body)
+	return err
+}
+
+// DuplicateFilter copies the filter and returns the copy.
+func (c *Client) DuplicateFilter(id int32) (*Filter, error) {
+	f := &Filter{}
+	data, err := c.SendRequest(http.MethodGet, c.config.Url.JoinPath(fmt.Sprintf("/api/filters/%v/duplicate", id)).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (c *Client) DeleteFilter(id int32) error {
+	_, err := c.SendRequest(http.MethodDelete, c.config.Url.JoinPath(fmt.Sprintf("/api/filters/%v", id)).String(), nil)
+	return err
+}
+
+// AddShows extends the shows of the filter with titles, keeping the ones it
+// already has. It returns the number of titles that were new.
+func (c *Client) AddShows(id int32, titles []string) (int, error) {
+	f, err := c.GetFilter(id)
+	if err != nil {
+		return 0, err
+	}
+
+	shows, added := MergeShows(f.Shows, titles)
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := c.UpdateFilter(id, FilterUpdate{Shows: &shows}); err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// MergeShows adds titles to the comma separated shows of a filter, skipping
+// the ones already there regardless of case. Commas in titles are replaced
+// by the ? wildcard so they don't split the title. It returns the new shows
+// and the number of titles added.
+func MergeShows(shows string, titles []string) (string, int) {
+	list := []string{}
+	seen := map[string]bool{}
+	for _, v := range strings.Split(shows, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[strings.ToLower(v)] {
+			continue
+		}
+
+		seen[strings.ToLower(v)] = true
+		list = append(list, v)
+	}
+
+	added := 0
+	for _, v := range titles {
+		v = strings.TrimSpace(strings.ReplaceAll(v, ",", "?"))
+		if v == "" || seen[strings.ToLower(v)] {
+			continue
+		}
+
+		seen[strings.ToLower(v)] = true
+		list = append(list, v)
+		added++
+	}
+
+	return strings.Join(list, ","), added
+}
+
+func (c *Client) SendRequest(method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	rb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("autobrr rejected the API key (%v)", resp.Status)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("response%v from autobrr:\n%v", method, string(rb))
+	}
+
+	return rb, nil
+}
@@ -1,17 +1,203 @@
 package config
 
-import "net/http"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
 
 type ApiKeyTransport struct {
 	Transport http.RoundTripper
-	ApiKey    string
+	// Header carries the key, X-Api-Key if empty.
+	Header string
+	ApiKey string
 }
 
 func (c *ApiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if c.Transport == nil {
-		c.Transport = http.DefaultTransport
+	header := c.Header
+	if header == "" {
+		header = "X-Api-Key"
 	}
 
-	req.Header.Add("X-Api-Key", c.ApiKey)
-	return c.Transport.RoundTrip(req)
+	req.Header.Add(header, c.ApiKey)
+	return roundTrip(c.Transport, req)
+}
+
+// HeaderTransport adds basic auth and extra headers to every request, for
+// instances behind a reverse proxy.
+type HeaderTransport struct {
+	Transport http.RoundTripper
+	Username  string
+	Password  string
+	Headers   map[string]string
+}
+
+func (c *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return roundTrip(c.Transport, req)
+}
+
+// roundTrip sends req with t, or the default transport if t is nil.
+func roundTrip(t http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if t == nil {
+		t = http.DefaultTransport
+	}
+
+	return t.RoundTrip(req)
+}
+
+// HTTPConfig are the settings for reaching an instance through a reverse
+// proxy or with a private certificate.
+type HTTPConfig struct {
+	Username string `koanf:"Username"`
+	Password string `koanf:"Password"`
+	// Headers are sent with every request, like the headers a forward-auth
+	// proxy expects.
+	Headers map[string]string `koanf:"Headers"`
+	// CACertFile is a PEM bundle trusted in addition to the system
+	// certificates.
+	CACertFile    string `koanf:"CACertFile"`
+	TLSSkipVerify bool   `koanf:"TLSSkipVerify"`
+	// Proxy is the URL of an HTTP proxy. HTTP_PROXY and HTTPS_PROXY are
+	// used when it is not set.
+	Proxy string `koanf:"Proxy"`
+
+	transport http.RoundTripper
+}
+
+// Transport builds the transport for the settings. It fails if the CA
+// bundle or the proxy URL can't be used.
+func (h *HTTPConfig) Transport() (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	proxy, err := h.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy != nil {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	pool, err := h.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	if pool != nil || h.TLSSkipVerify {
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, InsecureSkipVerify: h.TLSSkipVerify}
+	}
+
+	return &HeaderTransport{
+		Transport: t,
+		Username:  h.Username,
+		Password:  h.Password,
+		Headers:   h.Headers,
+	}, nil
+}
+
+func (h *HTTPConfig) proxyURL() (*url.URL, error) {
+	if h.Proxy == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(h.Proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", h.Proxy)
+	}
+
+	return u, nil
+}
+
+// rootCAs returns the system certificates together with CACertFile, or nil
+// if there is no CACertFile.
+func (h *HTTPConfig) rootCAs() (*x509.CertPool, error) {
+	if h.CACertFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(h.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", h.CACertFile)
+	}
+
+	return pool, nil
+}
+
+// RequestTimeout bounds every request to an instance, so one that hangs
+// can't stall a run.
+const RequestTimeout = 2 * time.Minute
+
+// Client returns an http.Client sending apiKey and the settings with every
+// request.
+func (h *HTTPConfig) Client(apiKey string) *http.Client {
+	return &http.Client{
+		Transport: &ApiKeyTransport{Transport: h.RoundTripper(), ApiKey: apiKey},
+		Timeout:   RequestTimeout,
+	}
+}
+
+// RoundTripper returns the transport for the settings. It is built when the
+// config is loaded; a config made up in code gets the default transport.
+func (h *HTTPConfig) RoundTripper() http.RoundTripper {
+	if h.transport != nil {
+		return h.transport
+	}
+
+	return &HeaderTransport{Username: h.Username, Password: h.Password, Headers: h.Headers}
+}
+
+// build sets up the transport when the config is loaded, so it is in place
+// before any request is sent. If the CA bundle or the proxy URL can't be
+// used, check reports it and every request fails with the same error rather
+// than going out without them.
+func (h *HTTPConfig) build() {
+	t, err := h.Transport()
+	if err != nil {
+		t = failingTransport{err: err}
+	}
+
+	h.transport = t
+}
+
+// failingTransport fails every request with err.
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// check reports what's wrong with the settings.
+func (h *HTTPConfig) check(section string) Problems {
+	p := Problems{}
+	if _, err := h.proxyURL(); err != nil {
+		p = append(p, Problem{Path: section + ".Proxy", Message: err.Error()})
+	}
+
+	if _, err := h.rootCAs(); err != nil {
+		p = append(p, Problem{Path: section + ".CACertFile", Message: err.Error()})
+	}
+
+	return p
 }
@@ -1,75 +1,588 @@
 package config
 
 import (
-	"log"
+	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/mitchellh/mapstructure"
 )
 
 type Config struct {
-	Sonarr *SonarrConfig
-	Radarr *RadarrConfig
+	Sonarr  []*SonarrConfig
+	Radarr  []*RadarrConfig
+	Search  *SearchConfig
+	Tags    *TagsConfig
+	Rules   []RuleConfig
+	Routes  []RouteConfig
+	Autobrr *AutobrrConfig
+	Serve   *ServeConfig
+	Daemon  *DaemonConfig
+	MAL     *MALConfig
+
+	problems Problems
+	k        *koanf.Koanf
+}
+
+// RouteConfig sends the titles its expression matches to the named Sonarr
+// and Radarr instances, or to the default ones when it names none, with the
+// instance settings of each app replaced by its overrides. The first
+// matching route wins; titles no route matches go to the instances marked
+// Default.
+type RouteConfig struct {
+	Name            string          `koanf:"Name"`
+	Expr            string          `koanf:"Expr"`
+	Sonarr          []string        `koanf:"Sonarr"`
+	Radarr          []string        `koanf:"Radarr"`
+	SonarrOverrides SonarrOverrides `koanf:"SonarrOverrides"`
+	RadarrOverrides RadarrOverrides `koanf:"RadarrOverrides"`
+}
+
+// SonarrOverrides replace Sonarr instance settings for the titles of a
+// route. Quality profiles are referenced by name. Empty fields keep the
+// instance setting.
+type SonarrOverrides struct {
+	QualityProfile string `koanf:"QualityProfile"`
+	RootFolderPath string `koanf:"RootFolderPath"`
+	SeriesType     string `koanf:"SeriesType"`
+	SeasonFolder   *bool  `koanf:"SeasonFolder"`
+}
+
+// RadarrOverrides are the Radarr counterpart of SonarrOverrides.
+type RadarrOverrides struct {
+	QualityProfile      string `koanf:"QualityProfile"`
+	RootFolderPath      string `koanf:"RootFolderPath"`
+	MinimumAvailability string `koanf:"MinimumAvailability"`
+}
+
+// RuleConfig is a named include or exclude rule evaluated against every
+// seasonal title, see package rules for the expression syntax. Include rules
+// pick from the titles on the list unless AnyStatus is set.
+type RuleConfig struct {
+	Name      string `koanf:"Name"`
+	Action    string `koanf:"Action"`
+	Expr      string `koanf:"Expr"`
+	AnyStatus bool   `koanf:"AnyStatus"`
+}
+
+// TagsConfig controls the tags every added title gets. Template may use
+// {season}, {year}, {status}, {media_type} and {username}. Genres, Ratings
+// and Sources map MAL values to tag labels, and every studio is tagged with
+// StudioPrefix in front of its name when it is set.
+type TagsConfig struct {
+	Template     string            `koanf:"Template"`
+	Genres       map[string]string `koanf:"Genres"`
+	Ratings      map[string]string `koanf:"Ratings"`
+	Sources      map[string]string `koanf:"Sources"`
+	StudioPrefix string            `koanf:"StudioPrefix"`
+}
+
+// SearchConfig decides which newly added titles are searched for right away.
+// Everything else is left for `shinkarr search`.
+type SearchConfig struct {
+	Statuses    []string `koanf:"Statuses"`
+	MinPriority string   `koanf:"MinPriority"`
 }
 
 type SonarrConfig struct {
-	Url              *url.URL
-	Host             string `koanf:"Host"`
-	Port             int    `koanf:"Port"`
-	BaseUrl          string `koanf:"BaseUrl"`
-	TLS              bool   `koanf:"TLS"`
-	ApiKey           string `koanf:"ApiKey"`
-	RootFolderPath   string `koanf:"RootFolderPath"`
-	SeasonFolder     bool   `koanf:"SeasonFolder"`
-	Monitored        bool   `koanf:"Monitored"`
-	MonitorType      string `koanf:"MonitorType"`
+	Name string
+	// Path is the table of the instance in the config file, like sonarr or
+	// sonarr.4k.
+	Path string `koanf:"-"`
+	// Url is the full address of the instance, like
+	// https://media.example/sonarr. Without it the address is made up of
+	// Host, Port, BaseUrl and TLS.
+	Url              *url.URL `koanf:"Url"`
+	Default          bool     `koanf:"Default"`
+	Host             string   `koanf:"Host"`
+	Port             int      `koanf:"Port"`
+	BaseUrl          string   `koanf:"BaseUrl"`
+	TLS              bool     `koanf:"TLS"`
+	ApiKey           string   `koanf:"ApiKey"`
+	RootFolderPath   string   `koanf:"RootFolderPath"`
+	SeasonFolder     bool     `koanf:"SeasonFolder"`
+	Monitored        bool     `koanf:"Monitored"`
+	MonitorType      string   `koanf:"MonitorType"`
+	SeriesType       string   `koanf:"SeriesType"`
+	QualityProfileID int32    `koanf:"QualityProfileID"`
+	// QualityProfile is the name of the quality profile and takes
+	// precedence over QualityProfileID. It is resolved at every run.
+	QualityProfile string `koanf:"QualityProfile"`
+	// LanguageProfileID is only used by Sonarr v3.
+	LanguageProfileID int32 `koanf:"LanguageProfileID"`
+	// MinFreeSpaceGB is the free space the root folder must have.
+	MinFreeSpaceGB int64 `koanf:"MinFreeSpaceGB"`
+	// Tags are added to every series alongside the templated tag.
+	Tags []string `koanf:"Tags"`
+	// MonitorUnwatchedOnly unmonitors episodes already watched on MAL for
+	// titles that are being watched.
+	MonitorUnwatchedOnly bool `koanf:"MonitorUnwatchedOnly"`
+	// Lifecycle maps a MAL list status (watching, on_hold, completed, ...)
+	// to the state a series should be moved to in Sonarr. It applies to
+	// every series shinkarr added, limited to the seasons the title maps to.
+	Lifecycle map[string]LifecycleRule `koanf:"Lifecycle"`
+
+	HTTPConfig `koanf:",squash"`
+}
+
+// LifecycleRule describes how a series in Sonarr is updated when its MAL
+// list status matches. Unset fields leave the series untouched. Monitored
+// false only unmonitors episodes that haven't aired yet; true also monitors
+// aired episodes that have no file.
+type LifecycleRule struct {
+	Monitored        *bool  `koanf:"Monitored"`
 	QualityProfileID int32  `koanf:"QualityProfileID"`
+	RootFolderPath   string `koanf:"RootFolderPath"`
+	MoveFiles        bool   `koanf:"MoveFiles"`
 }
 
 type RadarrConfig struct {
-	Url                 *url.URL
-	Host                string `koanf:"Host"`
-	Port                int    `koanf:"Port"`
-	BaseUrl             string `koanf:"BaseUrl"`
-	TLS                 bool   `koanf:"TLS"`
-	ApiKey              string `koanf:"ApiKey"`
-	RootFolderPath      string `koanf:"RootFolderPath"`
-	Monitored           bool   `koanf:"Monitored"`
-	MonitorType         string `koanf:"MonitorType"`
-	SearchForMovie      bool   `koanf:"SearchForMovie"`
-	MinimumAvailability string `konaf:"MinimumAvailability"`
-	QualityProfileID    int32  `koanf:"QualityProfileID"`
+	Name                string
+	Path                string   `koanf:"-"`
+	Url                 *url.URL `koanf:"Url"`
+	Default             bool     `koanf:"Default"`
+	Host                string   `koanf:"Host"`
+	Port                int      `koanf:"Port"`
+	BaseUrl             string   `koanf:"BaseUrl"`
+	TLS                 bool     `koanf:"TLS"`
+	ApiKey              string   `koanf:"ApiKey"`
+	RootFolderPath      string   `koanf:"RootFolderPath"`
+	Monitored           bool     `koanf:"Monitored"`
+	MonitorType         string   `koanf:"MonitorType"`
+	SearchForMovie      bool     `koanf:"SearchForMovie"`
+	MinimumAvailability string   `koanf:"MinimumAvailability"`
+	QualityProfileID    int32    `koanf:"QualityProfileID"`
+	// QualityProfile is the name of the quality profile and takes
+	// precedence over QualityProfileID. It is resolved at every run.
+	QualityProfile string `koanf:"QualityProfile"`
+	// MinFreeSpaceGB is the free space the root folder must have.
+	MinFreeSpaceGB int64 `koanf:"MinFreeSpaceGB"`
+	// Tags are added to every movie alongside the templated tag.
+	Tags []string `koanf:"Tags"`
+
+	HTTPConfig `koanf:",squash"`
 }
 
-func NewConfig(dir string) *Config {
+// configFiles are the file names Load looks for in the config directory,
+// in order. The first one found is used.
+var configFiles = []struct {
+	name   string
+	parser koanf.Parser
+}{
+	{"config.toml", toml.Parser()},
+	{"config.yaml", yaml.Parser()},
+	{"config.yml", yaml.Parser()},
+	{"config.json", json.Parser()},
+}
+
+// Load reads the config file from dir and layers the SHINKARR_ environment
+// variables over it: a setting in the environment takes precedence over the
+// file, and either a variable or its _FILE form may be set, not both. The
+// error is only about reading the config; settings that are missing or
+// invalid are listed by Problems.
+func Load(dir string) (*Config, error) {
 	if dir == "" {
-		log.Fatal("config location not found")
+		return nil, fmt.Errorf("config location not found")
+	}
+
+	k := koanf.New(".")
+	found := false
+	for _, f := range configFiles {
+		path := filepath.Join(dir, f.name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		if err := k.Load(file.Provider(path), f.parser); err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+
+		found = true
+		break
 	}
 
-	configPath := filepath.Join(dir, "config.toml")
+	env, problems := envKeys(os.Environ(), k)
+	if !found && len(env) == 0 && len(problems) == 0 {
+		return nil, fmt.Errorf("no config.toml, config.yaml or config.json found in %v", dir)
+	}
+
+	if err := k.Load(confmap.Provider(env, "."), nil); err != nil {
+		return nil, err
+	}
+
+	c := fromKoanf(k)
+	c.problems = append(problems, c.problems...)
+	return c, nil
+}
+
+// Parse reads a config from the contents of a config.toml.
+func Parse(b []byte) (*Config, error) {
 	k := koanf.New(".")
-	if err := k.Load(file.Provider(configPath), toml.Parser()); err != nil {
-		log.Fatal(err)
+	if err := k.Load(rawbytes.Provider(b), toml.Parser()); err != nil {
+		return nil, err
+	}
+
+	return fromKoanf(k), nil
+}
+
+func fromKoanf(k *koanf.Koanf) *Config {
+	c := &Config{}
+	unmarshal := func(path string, o interface{}) {
+		if err := k.UnmarshalWithConf(path, o, koanf.UnmarshalConf{DecoderConfig: decoderConfig(o)}); err != nil {
+			c.problems = append(c.problems, Problem{Path: path, Message: err.Error()})
+		}
+	}
+
+	sonarrs := []*SonarrConfig{}
+	for name, path := range instances(k, "sonarr") {
+		s := &SonarrConfig{Name: name, Path: path, SeriesType: "anime", MinFreeSpaceGB: 1}
+		unmarshal(path, s)
+		sonarrs = append(sonarrs, s)
+	}
+
+	radarrs := []*RadarrConfig{}
+	for name, path := range instances(k, "radarr") {
+		r := &RadarrConfig{Name: name, Path: path, MinimumAvailability: "released", MinFreeSpaceGB: 1}
+		unmarshal(path, r)
+		radarrs = append(radarrs, r)
 	}
 
-	s := SonarrConfig{}
-	r := RadarrConfig{}
-	k.Unmarshal("sonarr", &s)
-	k.Unmarshal("radarr", &r)
-	s.BuildUrl()
-	r.BuildUrl()
+	sort.Slice(sonarrs, func(i, j int) bool { return sonarrs[i].Name < sonarrs[j].Name })
+	sort.Slice(radarrs, func(i, j int) bool { return radarrs[i].Name < radarrs[j].Name })
+	if len(sonarrs) == 1 {
+		sonarrs[0].Default = true
+	}
+
+	if len(radarrs) == 1 {
+		radarrs[0].Default = true
+	}
+
+	se := SearchConfig{}
+	t := TagsConfig{Template: DefaultTagTemplate}
+	unmarshal("search", &se)
+	unmarshal("tags", &t)
+	var ab *AutobrrConfig
+	if k.Exists("autobrr") {
+		ab = &AutobrrConfig{SeasonFilterName: "Anime {season}-{year}", RetireAction: "disable"}
+		unmarshal("autobrr", ab)
+	}
+
+	sv := ServeConfig{Address: ":7575", CacheMinutes: 60}
+	unmarshal("serve", &sv)
+	dm := DaemonConfig{Schedule: "0 */6 * * *", RunOnStart: true}
+	unmarshal("daemon", &dm)
+	ml := MALConfig{NSFW: true, MediaTypes: map[string]string{}}
+	for k, v := range DefaultMediaTypes {
+		ml.MediaTypes[k] = v
+	}
+
+	unmarshal("mal", &ml)
+	rules := []RuleConfig{}
+	unmarshal("rules", &rules)
+	routes := []RouteConfig{}
+	unmarshal("routes", &routes)
+
+	c.Sonarr = sonarrs
+	c.Radarr = radarrs
+	c.Search = &se
+	c.Tags = &t
+	c.Rules = rules
+	c.Routes = routes
+	c.Autobrr = ab
+	c.Serve = &sv
+	c.Daemon = &dm
+	c.MAL = &ml
+	for _, key := range unknownKeys(k) {
+		c.problems = append(c.problems, Problem{Path: key, Message: "unknown key"})
+	}
+
+	c.problems = append(c.problems, c.check()...)
+	for _, s := range sonarrs {
+		s.BuildUrl()
+		s.HTTPConfig.build()
+	}
+
+	for _, r := range radarrs {
+		r.BuildUrl()
+		r.HTTPConfig.build()
+	}
 
-	return &Config{
-		Sonarr: &s,
-		Radarr: &r,
+	if ab != nil {
+		ab.BuildUrl()
+		ab.HTTPConfig.build()
 	}
+
+	c.k = k
+	return c
+}
+
+// decoderConfig is the koanf default with url.URL values parsed from
+// strings.
+func decoderConfig(o interface{}) *mapstructure.DecoderConfig {
+	return &mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			mapstructure.TextUnmarshallerHookFunc(),
+			stringToURL),
+		Result:           o,
+		WeaklyTypedInput: true,
+	}
+}
+
+func stringToURL(f, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(url.URL{}) {
+		return data, nil
+	}
+
+	u, err := url.Parse(data.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", data)
+	}
+
+	return u, nil
+}
+
+// Marshal returns the effective config as TOML. With redact, secrets are
+// replaced by REDACTED.
+func (c *Config) Marshal(redact bool) ([]byte, error) {
+	k := c.k.Copy()
+	if redact {
+		for _, key := range k.Keys() {
+			if isSecret(key) {
+				k.Set(key, "REDACTED")
+			}
+		}
+	}
+
+	return k.Marshal(toml.Parser())
+}
+
+// ServeConfig configures the import list endpoints of shinkarr serve.
+type ServeConfig struct {
+	Address string `koanf:"Address"`
+	// ApiKey, if set, must be given as the apikey query parameter or the
+	// X-Api-Key header.
+	ApiKey string `koanf:"ApiKey"`
+	// CacheMinutes is how long a MAL season is reused before it is fetched
+	// again.
+	CacheMinutes int `koanf:"CacheMinutes"`
+}
+
+// DefaultMediaTypes are the MAL media types and where their titles go unless
+// MediaTypes of [mal] says otherwise. MAL gives titles it hasn't classified
+// yet the type unknown; they go to Sonarr as they did before media types
+// could be configured.
+var DefaultMediaTypes = map[string]string{
+	"unknown":    "sonarr",
+	"tv":         "sonarr",
+	"ona":        "sonarr",
+	"ova":        "sonarr",
+	"special":    "sonarr",
+	"tv_special": "sonarr",
+	"movie":      "radarr",
+	"music":      "skip",
+}
+
+// MALConfig controls which seasonal titles are fetched from MAL and where
+// each media type goes.
+type MALConfig struct {
+	// NSFW includes titles MAL marks as not safe for work.
+	NSFW bool `koanf:"NSFW"`
+	// MediaTypes maps a MAL media type to sonarr, radarr or skip.
+	MediaTypes map[string]string `koanf:"MediaTypes"`
+}
+
+// Target returns sonarr, radarr or skip for a MAL media type. Media types
+// not in the table are skipped; unknown is in it and goes to Sonarr by
+// default.
+func (m *MALConfig) Target(mediaType string) string {
+	if t, ok := m.MediaTypes[mediaType]; ok {
+		return t
+	}
+
+	return "skip"
+}
+
+// DaemonConfig configures the runs of shinkarr daemon.
+type DaemonConfig struct {
+	// Schedule is a cron expression of minute, hour, day of month, month
+	// and day of week, in local time.
+	Schedule string `koanf:"Schedule"`
+	// NextSeason also syncs the season after the current one, whose titles
+	// are announced well before it starts.
+	NextSeason bool `koanf:"NextSeason"`
+	// RunOnStart runs once as soon as the daemon starts instead of waiting
+	// for the first scheduled time.
+	RunOnStart bool `koanf:"RunOnStart"`
+}
+
+// AutobrrConfig is the autobrr instance whose filter follows the added
+// titles.
+type AutobrrConfig struct {
+	Url     *url.URL `koanf:"Url"`
+	Host    string   `koanf:"Host"`
+	Port    int      `koanf:"Port"`
+	BaseUrl string   `koanf:"BaseUrl"`
+	TLS     bool     `koanf:"TLS"`
+	ApiKey  string   `koanf:"ApiKey"`
+	// FilterID is the filter whose shows are extended with the titles
+	// added on every run. 0 leaves the filters alone.
+	FilterID int32 `koanf:"FilterID"`
+	// SeasonTemplateID is a filter copied into a filter of its own for
+	// every season shinkarr runs for. 0 turns season filters off.
+	SeasonTemplateID int32 `koanf:"SeasonTemplateID"`
+	// SeasonFilterName names the season filters; {season} and {year} are
+	// replaced.
+	SeasonFilterName string `koanf:"SeasonFilterName"`
+	// RetireAction is what happens to a season filter once the season is
+	// over or every title of it is completed or dropped: disable or
+	// delete.
+	RetireAction string `koanf:"RetireAction"`
+
+	HTTPConfig `koanf:",squash"`
+}
+
+// Problems lists the settings of the config file that are unknown, missing
+// or invalid.
+func (c *Config) Problems() Problems {
+	return c.problems
+}
+
+// instances returns the config paths of the Sonarr or Radarr instances under
+// section keyed by instance name. A section holding the connection settings
+// directly, like [sonarr], is a single instance named after the section;
+// otherwise every sub-table, like [sonarr.4k], is an instance of its own.
+func instances(k *koanf.Koanf, section string) map[string]string {
+	m := map[string]string{}
+	if !k.Exists(section) {
+		return m
+	}
+
+	if k.Exists(section+".Host") || k.Exists(section+".Url") {
+		m[section] = section
+		return m
+	}
+
+	for _, name := range k.MapKeys(section) {
+		m[name] = section + "." + name
+	}
+
+	return m
+}
+
+func (c *Config) SonarrInstance(name string) *SonarrConfig {
+	for _, v := range c.Sonarr {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) RadarrInstance(name string) *RadarrConfig {
+	for _, v := range c.Radarr {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+const DefaultTagTemplate = "{season}-{year}"
+
+var invalidTagChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Render fills in the template variables and returns the resulting label.
+func (t *TagsConfig) Render(vars map[string]string) string {
+	label := t.Template
+	for k, v := range vars {
+		label = strings.ReplaceAll(label, "{"+k+"}", v)
+	}
+
+	return TagLabel(label)
+}
+
+// Metadata returns the tag labels for the MAL genres, studios, rating and
+// source of a title.
+func (t *TagsConfig) Metadata(genres, studios []string, rating, source string) []string {
+	labels := []string{}
+	for _, g := range genres {
+		if label, ok := t.Genres[g]; ok {
+			labels = append(labels, TagLabel(label))
+		}
+	}
+
+	if t.StudioPrefix != "" {
+		for _, s := range studios {
+			labels = append(labels, TagLabel(t.StudioPrefix+s))
+		}
+	}
+
+	if label, ok := t.Ratings[rating]; ok {
+		labels = append(labels, TagLabel(label))
+	}
+
+	if label, ok := t.Sources[source]; ok {
+		labels = append(labels, TagLabel(label))
+	}
+
+	return labels
+}
+
+// TagLabel turns s into a label Sonarr and Radarr accept: lower case
+// letters, digits and dashes only.
+func TagLabel(s string) string {
+	label := invalidTagChars.ReplaceAllString(strings.ToLower(s), "-")
+	return strings.Trim(label, "-")
+}
+
+var priorities = map[string]int{
+	"low":    0,
+	"medium": 1,
+	"high":   2,
+}
+
+// SearchNow reports whether a title with the given MAL list status and
+// priority should be searched for as soon as it is added.
+func (s *SearchConfig) SearchNow(status string, priority int) bool {
+	for _, v := range s.Statuses {
+		if v == status {
+			return true
+		}
+	}
+
+	if min, ok := priorities[s.MinPriority]; ok && priority >= min {
+		return true
+	}
+
+	return false
 }
 
 func (s *SonarrConfig) BuildUrl() {
+	if s.Url != nil {
+		return
+	}
+
 	scheme := "http"
 	if s.TLS {
 		scheme = "https"
@@ -84,6 +597,10 @@ func (s *SonarrConfig) BuildUrl() {
 }
 
 func (r *RadarrConfig) BuildUrl() {
+	if r.Url != nil {
+		return
+	}
+
 	scheme := "http"
 	if r.TLS {
 		scheme = "https"
@@ -96,3 +613,21 @@ func (r *RadarrConfig) BuildUrl() {
 
 	r.Url = url.JoinPath(r.BaseUrl)
 }
+
+func (a *AutobrrConfig) BuildUrl() {
+	if a.Url != nil {
+		return
+	}
+
+	scheme := "http"
+	if a.TLS {
+		scheme = "https"
+	}
+
+	url := url.URL{
+		Scheme: scheme,
+		Host:   a.Host + ":" + strconv.Itoa(a.Port),
+	}
+
+	a.Url = url.JoinPath(a.BaseUrl)
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/knadh/koanf"
+)
+
+// EnvPrefix starts every environment variable shinkarr reads. The rest of
+// the name is the path of the setting with underscores for dots, like
+// SHINKARR_SONARR_APIKEY for sonarr.ApiKey or SHINKARR_SONARR_4K_APIKEY for
+// sonarr.4k.ApiKey. Instance names match those of the config file whatever
+// their case. Appending _FILE reads the value from the named file instead,
+// for secrets mounted into containers.
+const EnvPrefix = "SHINKARR_"
+
+// envKeys turns the SHINKARR_ variables of environ into config keys, with
+// the instances named as they are in k, the config file.
+func envKeys(environ []string, k *koanf.Koanf) (map[string]interface{}, Problems) {
+	m := map[string]interface{}{}
+	set := map[string]string{}
+	p := Problems{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+
+		setting := strings.TrimPrefix(name, EnvPrefix)
+		if strings.HasSuffix(setting, "_FILE") {
+			setting = strings.TrimSuffix(setting, "_FILE")
+			b, err := os.ReadFile(value)
+			if err != nil {
+				p = append(p, Problem{Path: name, Message: err.Error()})
+				continue
+			}
+
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+
+		key, err := envKey(setting, k)
+		if err != nil {
+			p = append(p, Problem{Path: name, Message: err.Error()})
+			continue
+		}
+
+		if other, ok := set[key]; ok {
+			p = append(p, Problem{Path: name, Message: fmt.Sprintf("%v sets %v as well, set only one of them", other, key)})
+			continue
+		}
+
+		set[key] = name
+		m[key] = value
+	}
+
+	for _, section := range []string{"sonarr", "radarr"} {
+		single, named := "", ""
+		for key, name := range set {
+			if !strings.HasPrefix(key, section+".") {
+				continue
+			}
+
+			if strings.Count(key, ".") == 1 {
+				single = name
+			} else {
+				named = name
+			}
+		}
+
+		if single != "" && named != "" {
+			p = append(p, Problem{Path: named, Message: fmt.Sprintf("%v sets a single %v instance, name the instance in both or neither", single, section)})
+		}
+	}
+
+	return m, p
+}
+
+// envKey returns the config key for the variable name without its prefix.
+func envKey(setting string, k *koanf.Koanf) (string, error) {
+	parts := strings.Split(strings.ToLower(setting), "_")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("unknown key")
+	}
+
+	var (
+		section = parts[0]
+		t       reflect.Type
+	)
+
+	switch section {
+	case "sonarr", "radarr":
+		t = reflect.TypeOf(SonarrConfig{})
+		if section == "radarr" {
+			t = reflect.TypeOf(RadarrConfig{})
+		}
+
+		name, err := envInstance(k, section, strings.Join(parts[1:len(parts)-1], "_"))
+		if err != nil {
+			return "", err
+		}
+
+		if name != "" {
+			section += "." + name
+		}
+	default:
+		t = sections[section]
+		if t == nil || t.Kind() != reflect.Struct || len(parts) > 2 {
+			return "", fmt.Errorf("unknown key")
+		}
+	}
+
+	f, ok := field(t, parts[len(parts)-1])
+	if !ok {
+		return "", fmt.Errorf("unknown key")
+	}
+
+	name, _, _ := strings.Cut(f.Tag.Get("koanf"), ",")
+	return section + "." + name, nil
+}
+
+// envInstance returns the name the config file gives the instance of
+// section a variable names, lower case, or empty for a single instance.
+// Instances that aren't in the file are named as in the variable.
+func envInstance(k *koanf.Koanf, section, name string) (string, error) {
+	file := instances(k, section)
+	if _, single := file[section]; single {
+		if name != "" {
+			return "", fmt.Errorf("the config has a single [%v] instance, leave out the instance name", section)
+		}
+
+		return "", nil
+	}
+
+	if name == "" {
+		if len(file) > 0 {
+			return "", fmt.Errorf("the config names its %v instances, add the instance name", section)
+		}
+
+		return "", nil
+	}
+
+	matches := []string{}
+	for v := range file {
+		if strings.EqualFold(v, name) {
+			matches = append(matches, v)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return name, nil
+	case 1:
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	return "", fmt.Errorf("instance name is ambiguous, it matches %v", strings.Join(matches, ", "))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf"
+)
+
+// sections describes the top level tables of the config file.
+var sections = map[string]reflect.Type{
+	"search":  reflect.TypeOf(SearchConfig{}),
+	"tags":    reflect.TypeOf(TagsConfig{}),
+	"rules":   reflect.TypeOf([]RuleConfig{}),
+	"routes":  reflect.TypeOf([]RouteConfig{}),
+	"autobrr": reflect.TypeOf(AutobrrConfig{}),
+	"serve":   reflect.TypeOf(ServeConfig{}),
+	"daemon":  reflect.TypeOf(DaemonConfig{}),
+	"mal":     reflect.TypeOf(MALConfig{}),
+}
+
+// secretKeys are the settings Marshal redacts.
+var secretKeys = []string{"ApiKey", "Password"}
+
+// isSecret reports whether key holds a secret. Extra headers are treated as
+// secrets since they usually carry credentials.
+func isSecret(key string) bool {
+	parts := strings.Split(key, ".")
+	if len(parts) > 1 && strings.EqualFold(parts[len(parts)-2], "Headers") {
+		return true
+	}
+
+	for _, v := range secretKeys {
+		if strings.EqualFold(parts[len(parts)-1], v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unknownKeys returns the keys in k that no config field is loaded from.
+func unknownKeys(k *koanf.Koanf) []string {
+	unknown := []string{}
+	for key, v := range k.Raw() {
+		switch key {
+		case "sonarr":
+			unknown = append(unknown, instanceKeys(k, key, v, reflect.TypeOf(SonarrConfig{}))...)
+		case "radarr":
+			unknown = append(unknown, instanceKeys(k, key, v, reflect.TypeOf(RadarrConfig{}))...)
+		default:
+			t, ok := sections[key]
+			if !ok {
+				unknown = append(unknown, key)
+				continue
+			}
+
+			unknown = append(unknown, walkKeys(key, v, t)...)
+		}
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+func instanceKeys(k *koanf.Koanf, section string, v interface{}, t reflect.Type) []string {
+	if _, ok := instances(k, section)[section]; ok {
+		return walkKeys(section, v, t)
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return []string{section}
+	}
+
+	unknown := []string{}
+	for name, iv := range m {
+		unknown = append(unknown, walkKeys(section+"."+name, iv, t)...)
+	}
+
+	return unknown
+}
+
+// walkKeys compares the value loaded from path against the type it is
+// unmarshalled into, and returns the paths that have no matching field.
+func walkKeys(path string, v interface{}, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		unknown := []string{}
+		for key, fv := range m {
+			f, ok := field(t, key)
+			if !ok {
+				unknown = append(unknown, path+"."+key)
+				continue
+			}
+
+			unknown = append(unknown, walkKeys(path+"."+key, fv, f.Type)...)
+		}
+
+		return unknown
+
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		unknown := []string{}
+		for key, mv := range m {
+			unknown = append(unknown, walkKeys(path+"."+key, mv, t.Elem())...)
+		}
+
+		return unknown
+
+	case reflect.Slice:
+		l, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		unknown := []string{}
+		for i, lv := range l {
+			unknown = append(unknown, walkKeys(path+"["+strconv.Itoa(i)+"]", lv, t.Elem())...)
+		}
+
+		return unknown
+	}
+
+	return nil
+}
+
+// field finds the struct field key is loaded into, matching the koanf tag
+// case-insensitively like the decoder does. Squashed structs are searched
+// as well.
+func field(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("koanf")
+		if tag == ",squash" {
+			if sf, ok := field(f.Type, key); ok {
+				return sf, true
+			}
+
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" && strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/nstratos/go-myanimelist/mal"
+	"github.com/varoOP/shinkarr/internal/schedule"
+)
+
+// Problem is a setting of the config file that is unknown, missing or
+// invalid. Path is the TOML path of the setting.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// Problems is every problem found in a config file.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	lines := []string{}
+	for _, v := range p {
+		lines = append(lines, v.String())
+	}
+
+	return "invalid config:\n" + strings.Join(lines, "\n")
+}
+
+var listStatuses = []mal.AnimeStatus{
+	mal.AnimeStatusWatching,
+	mal.AnimeStatusCompleted,
+	mal.AnimeStatusOnHold,
+	mal.AnimeStatusDropped,
+	mal.AnimeStatusPlanToWatch,
+}
+
+func validListStatus(s string) bool {
+	for _, v := range listStatuses {
+		if string(v) == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check reports the settings that are required but missing, and the values
+// that can't be valid whatever the instances look like.
+func (c *Config) check() Problems {
+	p := Problems{}
+	for _, s := range c.Sonarr {
+		p = append(p, checkConnection(s.Path, s.Url, s.Host, s.Port, s.BaseUrl, s.ApiKey)...)
+		p = append(p, s.HTTPConfig.check(s.Path)...)
+		if s.RootFolderPath == "" {
+			p = append(p, Problem{Path: s.Path + ".RootFolderPath", Message: "required"})
+		}
+
+		for status := range s.Lifecycle {
+			if !validListStatus(status) {
+				p = append(p, Problem{Path: s.Path + ".Lifecycle." + status, Message: fmt.Sprintf("unknown MAL list status, must be one of %v", listStatuses)})
+			}
+		}
+	}
+
+	for _, r := range c.Radarr {
+		p = append(p, checkConnection(r.Path, r.Url, r.Host, r.Port, r.BaseUrl, r.ApiKey)...)
+		p = append(p, r.HTTPConfig.check(r.Path)...)
+		if r.RootFolderPath == "" {
+			p = append(p, Problem{Path: r.Path + ".RootFolderPath", Message: "required"})
+		}
+	}
+
+	if c.Autobrr != nil {
+		p = append(p, checkConnection("autobrr", c.Autobrr.Url, c.Autobrr.Host, c.Autobrr.Port, c.Autobrr.BaseUrl, c.Autobrr.ApiKey)...)
+		p = append(p, c.Autobrr.HTTPConfig.check("autobrr")...)
+		if c.Autobrr.RetireAction != "disable" && c.Autobrr.RetireAction != "delete" {
+			p = append(p, Problem{Path: "autobrr.RetireAction", Message: fmt.Sprintf("must be disable or delete, got %q", c.Autobrr.RetireAction)})
+		}
+	}
+
+	for _, status := range c.Search.Statuses {
+		if !validListStatus(status) {
+			p = append(p, Problem{Path: "search.Statuses", Message: fmt.Sprintf("unknown MAL list status %q, must be one of %v", status, listStatuses)})
+		}
+	}
+
+	if _, ok := priorities[c.Search.MinPriority]; c.Search.MinPriority != "" && !ok {
+		p = append(p, Problem{Path: "search.MinPriority", Message: fmt.Sprintf("must be low, medium or high, got %q", c.Search.MinPriority)})
+	}
+
+	configured := []string{}
+	for k := range c.MAL.MediaTypes {
+		configured = append(configured, k)
+	}
+
+	sort.Strings(configured)
+	for _, mediaType := range configured {
+		target := c.MAL.MediaTypes[mediaType]
+		if _, ok := DefaultMediaTypes[mediaType]; !ok {
+			p = append(p, Problem{Path: "mal.MediaTypes." + mediaType, Message: fmt.Sprintf("unknown MAL media type, must be one of %v", mediaTypes())})
+		}
+
+		if target != "sonarr" && target != "radarr" && target != "skip" {
+			p = append(p, Problem{Path: "mal.MediaTypes." + mediaType, Message: fmt.Sprintf("must be sonarr, radarr or skip, got %q", target)})
+		}
+	}
+
+	if _, err := schedule.Parse(c.Daemon.Schedule); err != nil {
+		p = append(p, Problem{Path: "daemon.Schedule", Message: err.Error()})
+	}
+
+	for i, r := range c.Rules {
+		if r.Expr == "" {
+			p = append(p, Problem{Path: fmt.Sprintf("rules[%v].Expr", i), Message: "required"})
+		}
+	}
+
+	for i, r := range c.Routes {
+		if r.Expr == "" {
+			p = append(p, Problem{Path: fmt.Sprintf("routes[%v].Expr", i), Message: "required"})
+		}
+	}
+
+	return p
+}
+
+// checkConnection checks that the settings of section make up a valid URL.
+// A full URL replaces the other settings.
+func checkConnection(section string, u *url.URL, host string, port int, baseUrl, apiKey string) Problems {
+	p := Problems{}
+	if apiKey == "" {
+		p = append(p, Problem{Path: section + ".ApiKey", Message: "required"})
+	}
+
+	if u != nil {
+		if host != "" {
+			p = append(p, Problem{Path: section + ".Host", Message: "set either Url or Host, Port and BaseUrl"})
+		}
+
+		return p
+	}
+
+	switch {
+	case host == "":
+		p = append(p, Problem{Path: section + ".Host", Message: "required"})
+	case strings.Contains(host, "://"):
+		p = append(p, Problem{Path: section + ".Host", Message: fmt.Sprintf("%q must be a host name without the scheme, set TLS for https", host)})
+	case strings.ContainsAny(host, "/:"):
+		p = append(p, Problem{Path: section + ".Host", Message: fmt.Sprintf("%q must be a host name, set Port and BaseUrl separately", host)})
+	}
+
+	if port < 1 || port > 65535 {
+		p = append(p, Problem{Path: section + ".Port", Message: fmt.Sprintf("must be between 1 and 65535, got %v", port)})
+	}
+
+	if u, err := url.Parse(baseUrl); err != nil || u.Scheme != "" || u.Host != "" {
+		p = append(p, Problem{Path: section + ".BaseUrl", Message: fmt.Sprintf("%q must be a path like /sonarr", baseUrl)})
+	}
+
+	return p
+}
+
+// mediaTypes returns the MAL media types in order.
+func mediaTypes() []string {
+	t := []string{}
+	for k := range DefaultMediaTypes {
+		t = append(t, k)
+	}
+
+	sort.Strings(t)
+	return t
+}
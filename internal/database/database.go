@@ -25,7 +25,31 @@ func NewDB(DSN string) *DB {
 	return db
 }
 
+// OpenReadOnly opens the database at path without changing it, unlike
+// NewDB, and returns an error if it isn't an sqlite database.
+func OpenReadOnly(path string) (*DB, error) {
+	h, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout%3d1000")
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	if err := h.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return &DB{Handler: h}, nil
+}
+
 func (db *DB) GetMalCreds() map[string]string {
+	creds, err := db.MalCreds()
+	check(err)
+	return creds
+}
+
+// MalCreds reads the MAL client credentials and token saved by shinkro.
+func (db *DB) MalCreds() (map[string]string, error) {
 	var (
 		client_id     string
 		client_secret string
@@ -37,23 +61,42 @@ func (db *DB) GetMalCreds() map[string]string {
 	row := db.Handler.QueryRow(sqlstmt)
 	err := row.Scan(&client_id, &client_secret, &access_token)
 	if err != nil {
-		check(err)
+		return nil, err
 	}
 
 	return map[string]string{
 		"client_id":     client_id,
 		"client_secret": client_secret,
 		"access_token":  access_token,
+	}, nil
+}
+
+// HasTable reports whether the database has a table called name.
+func (db *DB) HasTable(name string) (bool, error) {
+	var n int
+	err := db.Handler.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&n)
+	if err != nil {
+		return false, err
 	}
+
+	return n > 0, nil
+}
+
+// Match is a MAL title resolved to a tvdb or tmdb id.
+type Match struct {
+	Title string
+	ID    int32
 }
 
-func (db *DB) GetIDs(malids []int32, dbtype string) (map[string]int32, error) {
+// GetIDs resolves malids to tvdb or tmdb ids, falling back to maps for the
+// titles shinkro has no id for, and reports those that can't be resolved.
+func (db *DB) GetIDs(malids []int32, dbtype string, maps *Maps) (map[int32]Match, error) {
 	var (
 		notFound []string
 		// found    []string
 	)
 
-	m := map[string]int32{}
+	m := map[int32]Match{}
 	sqlstmt := fmt.Sprintf("SELECT title,%v_id from anime where mal_id=?", dbtype)
 	tx, err := db.Handler.Begin()
 	if err != nil {
@@ -75,26 +118,14 @@ func (db *DB) GetIDs(malids []int32, dbtype string) (map[string]int32, error) {
 
 		titleLink := fmt.Sprintf("%v (https://myanimelist.net/anime/%v)", title, malid)
 		if id <= 0 {
-			s, a, err := NewAnimeMaps()
-			if err != nil {
-				return nil, err
-			}
-
-			if dbtype == "tvdb" {
-				id = int32(s.CheckMap(int(malid)))
-			}
-
-			if dbtype == "tmdb" {
-				id = int32(a.CheckMap(int(malid)))
-			}
-
+			id = maps.ID(malid, dbtype)
 			if id <= 0 {
 				notFound = append(notFound, fmt.Sprintf("Title: %v\nLink: https://myanimelist.net/anime/%v\n", title, malid))
 				continue
 			}
 		}
 		// found = append(found, title)
-		m[titleLink] = id
+		m[malid] = Match{Title: titleLink, ID: id}
 	}
 
 	// if len(found) > 0 {
@@ -118,6 +149,31 @@ func (db *DB) GetIDs(malids []int32, dbtype string) (map[string]int32, error) {
 	return m, nil
 }
 
+// LookupIDs resolves malids to tvdb or tmdb ids keyed by mal id, falling back
+// to maps like GetIDs. Titles that cannot be resolved are left out of the
+// result.
+func (db *DB) LookupIDs(malids []int32, dbtype string, maps *Maps) (map[int32]int32, error) {
+	m := map[int32]int32{}
+	sqlstmt := fmt.Sprintf("SELECT %v_id from anime where mal_id=?", dbtype)
+	for _, malid := range malids {
+		var id int32
+		err := db.Handler.QueryRow(sqlstmt, malid).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		if id <= 0 {
+			id = maps.ID(malid, dbtype)
+		}
+
+		if id > 0 {
+			m[malid] = id
+		}
+	}
+
+	return m, nil
+}
+
 func check(err error) {
 	if err != nil {
 		log.Fatalf("database error: %v", err)
@@ -1,8 +1,11 @@
 package database
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,8 +13,16 @@ import (
 const (
 	communityMapTVDB = "https://github.com/varoOP/shinkro-mapping/raw/main/tvdb-mal.yaml"
 	communityMapTMDB = "https://github.com/varoOP/shinkro-mapping/raw/main/tmdb-mal.yaml"
+	communityCommits = "https://api.github.com/repos/varoOP/shinkro-mapping/commits"
 )
 
+// mappingClient fetches the community mapping, giving up on requests that
+// hang.
+var mappingClient = &http.Client{Timeout: 2 * time.Minute}
+
+// CommunityMaps are the files of the community mapping repository.
+var CommunityMaps = []string{"tvdb-mal.yaml", "tmdb-mal.yaml"}
+
 type AnimeTVDBMap struct {
 	Anime []Anime `yaml:"AnimeMap" json:"AnimeMap"`
 }
@@ -25,11 +36,48 @@ type Anime struct {
 	Start        int            `yaml:"start" json:"start"`
 	UseMapping   bool           `yaml:"useMapping" json:"useMapping"`
 	AnimeMapping []AnimeMapping `yaml:"animeMapping" json:"animeMapping"`
+
+	// hasSeason is set when the entry gives tvdbseason rather than leaving
+	// it at 0 by omission.
+	hasSeason bool
 }
 
 type AnimeMapping struct {
 	TvdbSeason int `yaml:"tvdbseason" json:"tvdbseason"`
 	Start      int `yaml:"start" json:"start"`
+
+	hasSeason bool
+}
+
+func (a *Anime) UnmarshalYAML(n *yaml.Node) error {
+	type plain Anime
+	if err := n.Decode((*plain)(a)); err != nil {
+		return err
+	}
+
+	a.hasSeason = hasKey(n, "tvdbseason")
+	return nil
+}
+
+func (m *AnimeMapping) UnmarshalYAML(n *yaml.Node) error {
+	type plain AnimeMapping
+	if err := n.Decode((*plain)(m)); err != nil {
+		return err
+	}
+
+	m.hasSeason = hasKey(n, "tvdbseason")
+	return nil
+}
+
+// hasKey reports whether the mapping node n has key.
+func hasKey(n *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
 }
 
 type AnimeMovies struct {
@@ -42,8 +90,34 @@ type AnimeMovie struct {
 	MALID     int    `yaml:"malid" json:"malid"`
 }
 
-func NewAnimeMaps() (*AnimeTVDBMap, *AnimeMovies, error) {
-	return loadCommunityMaps()
+// Maps are the community mappings, downloaded once and shared by the lookups
+// of a run.
+type Maps struct {
+	TVDB   *AnimeTVDBMap
+	Movies *AnimeMovies
+}
+
+// LoadMaps downloads the community mappings.
+func LoadMaps() (*Maps, error) {
+	s, a, err := loadCommunityMaps()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Maps{TVDB: s, Movies: a}, nil
+}
+
+// ID returns the tvdb or tmdb id the mapping gives malid, or 0 if it has
+// none.
+func (m *Maps) ID(malid int32, dbtype string) int32 {
+	switch dbtype {
+	case "tvdb":
+		return int32(m.TVDB.CheckMap(int(malid)))
+	case "tmdb":
+		return int32(m.Movies.CheckMap(int(malid)))
+	}
+
+	return 0
 }
 
 func (s *AnimeTVDBMap) CheckMap(malid int) int {
@@ -56,6 +130,40 @@ func (s *AnimeTVDBMap) CheckMap(malid int) int {
 	return 0
 }
 
+// Find returns the mapping entry for malid, or nil if there is none.
+func (s *AnimeTVDBMap) Find(malid int) *Anime {
+	for i := range s.Anime {
+		if s.Anime[i].Malid == malid {
+			return &s.Anime[i]
+		}
+	}
+
+	return nil
+}
+
+// Seasons lists the TVDB seasons the MAL entry spans, in order, with the
+// TVDB episode each of them starts at.
+func (a *Anime) Seasons() []AnimeMapping {
+	if a.UseMapping && len(a.AnimeMapping) > 0 {
+		return a.AnimeMapping
+	}
+
+	return []AnimeMapping{{TvdbSeason: a.TvdbSeason, Start: a.Start, hasSeason: a.hasSeason}}
+}
+
+// IsSpecial reports whether the MAL entry is made up of specials episodes,
+// season 0 on TVDB, rather than a season of its own. The mapping has to
+// give season 0; an entry without a season isn't taken for one.
+func (a *Anime) IsSpecial() bool {
+	for _, s := range a.Seasons() {
+		if s.TvdbSeason != 0 || !s.hasSeason {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (am *AnimeMovies) CheckMap(malid int) int {
 	for _, animeMovie := range am.AnimeMovie {
 		if animeMovie.MALID == malid {
@@ -68,7 +176,7 @@ func (am *AnimeMovies) CheckMap(malid int) int {
 
 func loadCommunityMaps() (*AnimeTVDBMap, *AnimeMovies, error) {
 	s := &AnimeTVDBMap{}
-	respTVDB, err := http.Get(communityMapTVDB)
+	respTVDB, err := mappingClient.Get(communityMapTVDB)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -79,7 +187,7 @@ func loadCommunityMaps() (*AnimeTVDBMap, *AnimeMovies, error) {
 	}
 
 	am := &AnimeMovies{}
-	respTMDB, err := http.Get(communityMapTMDB)
+	respTMDB, err := mappingClient.Get(communityMapTMDB)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -106,3 +214,34 @@ func readYamlHTTP(resp *http.Response, mapping interface{}) error {
 
 	return nil
 }
+
+// MapUpdated returns the time of the last commit to the community mapping
+// file name.
+func MapUpdated(name string) (time.Time, error) {
+	resp, err := mappingClient.Get(fmt.Sprintf("%v?path=%v&per_page=1", communityCommits, name))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("GitHub returned %v", resp.Status)
+	}
+
+	commits := []struct {
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		return time.Time{}, err
+	}
+
+	if len(commits) == 0 {
+		return time.Time{}, fmt.Errorf("%v not found in the mapping repository", name)
+	}
+
+	return commits[0].Commit.Committer.Date, nil
+}
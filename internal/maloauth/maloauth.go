@@ -5,14 +5,51 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/varoOP/shinkarr/internal/database"
 	"golang.org/x/oauth2"
 )
 
 func NewOauth2Client(db *database.DB) *http.Client {
-	ctx := context.Background()
-	creds := db.GetMalCreds()
+	client, err := NewClient(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return client
+}
+
+// requestTimeout bounds every request to MAL, token refreshes included.
+const requestTimeout = 2 * time.Minute
+
+// NewClient returns an http.Client authorized with the MAL token saved by
+// shinkro, refreshing the token first if it has expired.
+func NewClient(db *database.DB) (*http.Client, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: requestTimeout})
+	cfg, t, err := Token(db)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh_token, err := cfg.TokenSource(ctx, t).Token()
+	if err != nil {
+		return nil, err
+	}
+
+	c := cfg.Client(ctx, fresh_token)
+	c.Timeout = requestTimeout
+	return c, nil
+}
+
+// Token reads the MAL oauth2 config and the token saved by shinkro. The token
+// may have expired; the config's TokenSource refreshes it.
+func Token(db *database.DB) (*oauth2.Config, *oauth2.Token, error) {
+	creds, err := db.MalCreds()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	cfg := &oauth2.Config{
 		ClientID:     creds["client_id"],
 		ClientSecret: creds["client_secret"],
@@ -24,16 +61,10 @@ func NewOauth2Client(db *database.DB) *http.Client {
 	}
 
 	t := &oauth2.Token{}
-	err := json.Unmarshal([]byte(creds["access_token"]), t)
+	err = json.Unmarshal([]byte(creds["access_token"]), t)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, nil, err
 	}
 
-	fresh_token, err := cfg.TokenSource(ctx, t).Token()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	client := cfg.Client(ctx, fresh_token)
-	return client
+	return cfg, t, nil
 }
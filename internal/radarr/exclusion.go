@@ -0,0 +1,63 @@
+package radarr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ImportExclusion is a movie Radarr won't add from import lists.
+type ImportExclusion struct {
+	Id         int32  `json:"id,omitempty"`
+	TmdbId     int32  `json:"tmdbId"`
+	MovieTitle string `json:"movieTitle"`
+	MovieYear  int32  `json:"movieYear"`
+}
+
+// GetExclusions returns the tmdb ids of the import exclusions.
+func (c *Client) GetExclusions() (map[int32]bool, error) {
+	e := []ImportExclusion{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/exclusions").String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	ids := map[int32]bool{}
+	for _, v := range e {
+		ids[v.TmdbId] = true
+	}
+
+	return ids, nil
+}
+
+// AddExclusion adds the movie to the import exclusions, unless it is
+// already there.
+func (c *Client) AddExclusion(tmdbid int32, title string, year int32) error {
+	excluded, err := c.GetExclusions()
+	if err != nil {
+		return err
+	}
+
+	if excluded[tmdbid] {
+		return nil
+	}
+
+	p, err := json.Marshal(ImportExclusion{TmdbId: tmdbid, MovieTitle: title, MovieYear: year})
+	if err != nil {
+		return err
+	}
+
+	_, re, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/exclusions").String(), p)
+	if err != nil {
+		return err
+	}
+
+	if re != nil {
+		return fmt.Errorf("%v: %v", re.PropertyName, re.ErrorMessage)
+	}
+
+	return nil
+}
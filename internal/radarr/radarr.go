@@ -98,6 +98,19 @@ const (
 	Tba       MovieStatusType = "tba"
 )
 
+// MinimumAvailabilityValues are the statuses a movie can be monitored from.
+var MinimumAvailabilityValues = []MovieStatusType{Announced, InCinemas, Released}
+
+func ValidMinimumAvailability(s string) bool {
+	for _, v := range MinimumAvailabilityValues {
+		if string(v) == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 type MediaCoverTypes string
 
 const (
@@ -152,6 +165,18 @@ const (
 	MonitorTypesNone               MonitorTypes = "none"
 )
 
+var MonitorTypeValues = []MonitorTypes{MonitorTypesMovieAndCollection, MonitorTypesMovieOnly, MonitorTypesNone}
+
+func ValidMonitorType(s string) bool {
+	for _, v := range MonitorTypeValues {
+		if string(v) == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 type AlternativeTitleResource struct {
 	CleanTitle      string     `json:"cleanTitle"`
 	Id              int32      `json:"id,omitempty"`
@@ -368,6 +393,15 @@ type Tag struct {
 	Label string `json:"label"`
 }
 
+type Command struct {
+	Id       int32   `json:"id,omitempty"`
+	Name     string  `json:"name"`
+	MovieIds []int32 `json:"movieIds,omitempty"`
+	Status   string  `json:"status,omitempty"`
+}
+
+const CommandMoviesSearch = "MoviesSearch"
+
 type RadarrErrorMessage string
 
 const ErrorMessageMovieAlreadyAdded RadarrErrorMessage = "This movie has already been added"
@@ -387,33 +421,49 @@ type RadarrError struct {
 
 type Client struct {
 	client *http.Client
-	config *config.Config
+	config *config.RadarrConfig
 }
 
-func NewClient(cfg *config.Config) *Client {
-	c := &http.Client{
-		Transport: &config.ApiKeyTransport{ApiKey: cfg.Radarr.ApiKey},
-	}
-
+func NewClient(cfg *config.RadarrConfig) *Client {
 	return &Client{
 		config: cfg,
-		client: c,
+		client: cfg.Client(cfg.ApiKey),
+	}
+}
+
+// MovieOptions are the settings a movie is added with. NewMovieOptions
+// fills them in from the instance config.
+type MovieOptions struct {
+	QualityProfileId    int32
+	RootFolderPath      string
+	MinimumAvailability MovieStatusType
+	Search              bool
+}
+
+func (c *Client) NewMovieOptions() MovieOptions {
+	return MovieOptions{
+		QualityProfileId:    c.config.QualityProfileID,
+		RootFolderPath:      c.config.RootFolderPath,
+		MinimumAvailability: MovieStatusType(c.config.MinimumAvailability),
+		Search:              c.config.SearchForMovie,
 	}
 }
 
-func (c *Client) AddMovie(title string, tmdbid int32, tags []int32) error {
+// AddMovie adds the movie and reports whether it was created; a movie that
+// was already added only gets the missing tags.
+func (c *Client) AddMovie(title string, tmdbid int32, tags []int32, opts MovieOptions) (bool, error) {
 	m := Movie{
 		Title:               title,
-		MinimumAvailability: MovieStatusType(c.config.Radarr.MinimumAvailability),
-		QualityProfileId:    c.config.Radarr.QualityProfileID,
-		Monitored:           c.config.Radarr.Monitored,
+		MinimumAvailability: opts.MinimumAvailability,
+		QualityProfileId:    opts.QualityProfileId,
+		Monitored:           c.config.Monitored,
 		TmdbId:              tmdbid,
-		RootFolderPath:      c.config.Radarr.RootFolderPath,
+		RootFolderPath:      opts.RootFolderPath,
 		AddOptions: AddMovieOptions{
 			IgnoreEpisodesWithFiles:    false,
 			IgnoreEpisodesWithoutFiles: false,
-			Monitor:                    MonitorTypes(c.config.Radarr.MonitorType),
-			SearchForMovie:             c.config.Radarr.SearchForMovie,
+			Monitor:                    MonitorTypes(c.config.MonitorType),
+			SearchForMovie:             opts.Search,
 			AddMethod:                  AddMovieMethodManual,
 		},
 		Tags: tags,
@@ -421,40 +471,47 @@ func (c *Client) AddMovie(title string, tmdbid int32, tags []int32) error {
 
 	p, err := json.Marshal(m)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, me, err := c.SendPostRequest(c.config.Radarr.Url.JoinPath("/api/v3/movie").String(), p)
+	_, me, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/movie").String(), p)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if me != nil {
 		if me.ErrorMessage == string(ErrorMessageMovieAlreadyAdded) {
 			mm, err := c.GetMovie(m.TmdbId)
 			if err != nil {
-				return err
+				return false, err
 			}
 
-			if mm[0].HaveTag(tags[0]) {
-				return nil
+			if mm[0].HaveTags(tags) {
+				return false, nil
 			} else {
-				err = c.PutSeries(m.Id, mm, tags)
+				err = c.PutSeries(mm[0].Id, mm, tags)
 				if err != nil {
-					return err
+					return false, err
 				}
 
-				return nil
+				return false, nil
 			}
 		}
+
+		return false, fmt.Errorf("%v: %v", me.PropertyName, me.ErrorMessage)
 	}
 
-	return nil
+	return true, nil
 }
 
 func (c *Client) PutSeries(id int32, m []Movie, tags []int32) error {
-	u := c.config.Radarr.Url.JoinPath(fmt.Sprintf("/api/v3/movie/%v", id))
-	m[0].Tags = append(m[0].Tags, tags[0])
+	u := c.config.Url.JoinPath(fmt.Sprintf("/api/v3/movie/%v", id))
+	for _, t := range tags {
+		if !m[0].HaveTag(t) {
+			m[0].Tags = append(m[0].Tags, t)
+		}
+	}
+
 	body, err := json.MarshalIndent(m[0], "", "  ")
 	if err != nil {
 		return err
@@ -468,6 +525,16 @@ func (c *Client) PutSeries(id int32, m []Movie, tags []int32) error {
 	return nil
 }
 
+func (m *Movie) HaveTags(ids []int32) bool {
+	for _, id := range ids {
+		if !m.HaveTag(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (m *Movie) HaveTag(id int32) bool {
 	for _, v := range m.Tags {
 		if v == id {
@@ -480,7 +547,7 @@ func (m *Movie) HaveTag(id int32) bool {
 
 func (c *Client) GetMovie(tmdbid int32) ([]Movie, error) {
 	m := []Movie{}
-	u := c.config.Radarr.Url.JoinPath("/api/v3/movie")
+	u := c.config.Url.JoinPath("/api/v3/movie")
 	params := u.Query()
 	params.Add("tmdbId", fmt.Sprintf("%v", tmdbid))
 	u.RawQuery = params.Encode()
@@ -498,6 +565,43 @@ func (c *Client) GetMovie(tmdbid int32) ([]Movie, error) {
 	return m, nil
 }
 
+func (c *Client) GetAllMovies() ([]Movie, error) {
+	m := []Movie{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/movie").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SearchMovies queues a search for the given movies.
+func (c *Client) SearchMovies(ids []int32) error {
+	p, err := json.Marshal(Command{
+		Name:     CommandMoviesSearch,
+		MovieIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, me, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/command").String(), p)
+	if err != nil {
+		return err
+	}
+
+	if me != nil {
+		return fmt.Errorf("%v", me.ErrorMessage)
+	}
+
+	return nil
+}
+
 func (c *Client) AddTag(label string) (int32, error) {
 	t := Tag{
 		Label: label,
@@ -508,7 +612,7 @@ func (c *Client) AddTag(label string) (int32, error) {
 		return -1, err
 	}
 
-	url := c.config.Radarr.Url.JoinPath("/api/v3/tag").String()
+	url := c.config.Url.JoinPath("/api/v3/tag").String()
 	resp, _, err := c.SendPostRequest(url, p)
 	if err != nil {
 		return -1, err
@@ -522,15 +626,39 @@ func (c *Client) AddTag(label string) (int32, error) {
 	return t.Id, nil
 }
 
-func (c *Client) TagExists(label string) (bool, int32, error) {
+func (c *Client) GetTags() ([]Tag, error) {
 	var tags []Tag
-	url := c.config.Radarr.Url.JoinPath("/api/v3/tag").String()
+	url := c.config.Url.JoinPath("/api/v3/tag").String()
 	data, err := c.SendGetRequest(url)
 	if err != nil {
-		return false, -1, err
+		return nil, err
 	}
 
 	err = json.Unmarshal(data, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetTagMap returns the ids of all tags keyed by label.
+func (c *Client) GetTagMap() (map[string]int32, error) {
+	tags, err := c.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]int32{}
+	for _, v := range tags {
+		m[v.Label] = v.Id
+	}
+
+	return m, nil
+}
+
+func (c *Client) TagExists(label string) (bool, int32, error) {
+	tags, err := c.GetTags()
 	if err != nil {
 		return false, -1, err
 	}
@@ -581,6 +709,10 @@ func (c *Client) SendGetRequest(url string) ([]byte, error) {
 		return nil, err
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("radarr rejected the API key (401 Unauthorized)")
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("responseGet from Radarr:\n%v", string(rb))
 	}
@@ -0,0 +1,602 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/varoOP/shinkarr/internal/anime"
+)
+
+// Expr is a compiled rule expression. Expressions are made of field names,
+// numbers, "strings", [lists], true and false, combined with
+//
+//	== != < <= > >= in, not in, && (and), || (or), ! (not) and parentheses.
+//
+// `x in list` tests membership and `x in "string"` tests for a substring.
+// String equality ignores case. Strings are quoted with " or ' and may
+// contain \", \' and \\. Field names are those of anime.Anime.Env.
+type Expr struct {
+	src  string
+	root node
+}
+
+// fields are the names an expression may refer to.
+var fields = (&anime.Anime{}).Env()
+
+// Compile parses src and checks that every field it names exists.
+func Compile(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %v", p.peek().text, p.peek().pos)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match evaluates the expression against env, which must produce a bool.
+func (e *Expr) Match(env map[string]any) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q does not produce true or false", e.src)
+	}
+
+	return b, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func lex(src string) ([]token, error) {
+	toks := []token{}
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			start := i
+			text, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %v", err, start+n)
+			}
+
+			toks = append(toks, token{kind: tokString, text: text, pos: start})
+			i += n
+
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			i++
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], pos: start})
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at position %v", string(c), i)
+			}
+		}
+	}
+
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexString reads the quoted string s starts with and returns its text and
+// length. On error n is the offset of the problem.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	b := strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return b.String(), i + 1, nil
+
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+
+			switch s[i+1] {
+			case '"', '\'', '\\':
+				b.WriteByte(s[i+1])
+				i++
+			default:
+				return "", i, fmt.Errorf("invalid escape %q", s[i:i+2])
+			}
+
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators or
+// keywords.
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+
+	for _, v := range texts {
+		if t.text == v {
+			p.next()
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+
+		return fmt.Errorf("expected %q, found %q at position %v", text, t.text, t.pos)
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{n: n}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in"); ok {
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+
+	if _, ok := p.accept("not"); ok {
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{n: &compareNode{op: "in", left: left, right: right}}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %v", t.text, t.pos)
+		}
+
+		return &literalNode{v: f}, nil
+
+	case tokString:
+		return &literalNode{v: t.text}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		case "and", "or", "not", "in":
+			return nil, fmt.Errorf("unexpected %q at position %v", t.text, t.pos)
+		}
+
+		if _, ok := fields[t.text]; !ok {
+			return nil, fmt.Errorf("unknown field %q at position %v, must be one of %v", t.text, t.pos, fieldNames())
+		}
+
+		return &fieldNode{name: t.text}, nil
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return n, nil
+
+		case "[":
+			items := []node{}
+			if _, ok := p.accept("]"); ok {
+				return &listNode{items: items}, nil
+			}
+
+			for {
+				n, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, n)
+				if _, ok := p.accept(","); ok {
+					continue
+				}
+
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+
+				return &listNode{items: items}, nil
+			}
+		}
+	}
+
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %v", t.text, t.pos)
+}
+
+func fieldNames() string {
+	names := []string{}
+	for k := range fields {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+type node interface {
+	eval(env map[string]any) (any, error)
+}
+
+type literalNode struct {
+	v any
+}
+
+func (n *literalNode) eval(env map[string]any) (any, error) {
+	return n.v, nil
+}
+
+type fieldNode struct {
+	name string
+}
+
+func (n *fieldNode) eval(env map[string]any) (any, error) {
+	v, ok := env[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", n.name)
+	}
+
+	return v, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env map[string]any) (any, error) {
+	l := []any{}
+	for _, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		l = append(l, v)
+	}
+
+	return l, nil
+}
+
+type notNode struct {
+	n node
+}
+
+func (n *notNode) eval(env map[string]any) (any, error) {
+	v, err := n.n.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %v", describe(v))
+	}
+
+	return !b, nil
+}
+
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(env map[string]any) (any, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	lb, ok := l.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected true or false, got %v", describe(l))
+	}
+
+	if lb == n.or {
+		return lb, nil
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	rb, ok := r.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected true or false, got %v", describe(r))
+	}
+
+	return rb, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env map[string]any) (any, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "in" {
+		switch rv := r.(type) {
+		case []any:
+			for _, v := range rv {
+				if equal(l, v) {
+					return true, nil
+				}
+			}
+
+			return false, nil
+
+		case string:
+			ls, ok := l.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot look for %v in a string", describe(l))
+			}
+
+			return strings.Contains(rv, ls), nil
+		}
+
+		return nil, fmt.Errorf("cannot look for a value in %v", describe(r))
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if lok && rok {
+		switch n.op {
+		case "<":
+			return lf < rf, nil
+		case "<=":
+			return lf <= rf, nil
+		case ">":
+			return lf > rf, nil
+		case ">=":
+			return lf >= rf, nil
+		}
+	}
+
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		switch n.op {
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot compare %v %v %v", describe(l), n.op, describe(r))
+}
+
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+
+		return true
+	case string:
+		bv, ok := b.(string)
+		return ok && strings.EqualFold(av, bv)
+	}
+
+	return a == b
+}
+
+func describe(v any) string {
+	switch v.(type) {
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "true or false"
+	case []any:
+		return "a list"
+	}
+
+	return fmt.Sprintf("%v", v)
+}
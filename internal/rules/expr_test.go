@@ -0,0 +1,126 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func testEnv() map[string]any {
+	return map[string]any{
+		"title":          "Frieren: Beyond Journey's End",
+		"media_type":     "tv",
+		"mean":           9.1,
+		"num_list_users": 900000.0,
+		"genres":         []any{"Adventure", "Drama", "Fantasy"},
+		"list_status":    "",
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// && binds tighter than ||, ! tighter than both.
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!false && false`, false},
+		{`!(false && false)`, true},
+		{`not true or true`, true},
+		{`mean > 9 and media_type == "TV" or false`, true},
+		{`mean > 9 && (media_type == "movie" || num_list_users >= 900000)`, true},
+
+		{`"Drama" in genres`, true},
+		{`"drama" in genres`, true},
+		{`"Kids" in genres`, false},
+		{`"Kids" not in genres`, true},
+		{`"Drama" not in genres`, false},
+		{`media_type in ["tv", "ona"]`, true},
+		{`media_type not in ["tv", "ona"]`, false},
+		{`media_type in []`, false},
+		{`"Journey" in title`, true},
+		{`!("Journey" in title)`, false},
+
+		{`title == "Frieren: Beyond Journey's End"`, true},
+		{`title == 'Frieren: Beyond Journey\'s End'`, true},
+		{`"a\"b" == 'a"b'`, true},
+		{`"a\\b" in ["a\\b"]`, true},
+		{`list_status == ""`, true},
+		{`mean >= -1`, true},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+
+		got, err := e.Match(testEnv())
+		if err != nil {
+			t.Errorf("Match(%q): %v", tt.expr, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`meen > 7`, `unknown field "meen" at position 0`},
+		{`mean > 7 && genre in ["a"]`, `unknown field "genre" at position 12`},
+		{`mean >`, `unexpected end of expression`},
+		{`mean > 7 )`, `unexpected ")" at position 9`},
+		{`(mean > 7`, `expected ")" at end of expression`},
+		{`[1, 2 3]`, `expected "]", found "3" at position 6`},
+		{`mean # 7`, `unexpected "#" at position 5`},
+		{`title == "abc`, `unterminated string at position 9`},
+		{`title == "a\`, `unterminated string at position 9`},
+		{`title == "a\nb"`, `invalid escape "\\n" at position 11`},
+		{`"a" not "b"`, `expected "in", found "b" at position 8`},
+		{`mean > and`, `unexpected "and" at position 7`},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want error %q", tt.expr, tt.want)
+			continue
+		}
+
+		if !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) = %q, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`mean`, `does not produce true or false`},
+		{`!mean`, `cannot negate a number`},
+		{`mean in title`, `cannot look for a number in a string`},
+		{`title < 3`, `cannot compare a string < a number`},
+	}
+
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+
+		_, err = e.Match(testEnv())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Match(%q) = %v, want error containing %q", tt.expr, err, tt.want)
+		}
+	}
+}
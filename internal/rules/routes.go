@@ -0,0 +1,121 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/varoOP/shinkarr/internal/config"
+)
+
+type Route struct {
+	Name            string
+	Expr            *Expr
+	Sonarr          []string
+	Radarr          []string
+	SonarrOverrides config.SonarrOverrides
+	RadarrOverrides config.RadarrOverrides
+}
+
+// Targets are the Sonarr and Radarr instances a title is sent to, and the
+// settings it overrides in each app. Route is empty when the title went to
+// the default instances.
+type Targets struct {
+	Route           string
+	Sonarr          []string
+	Radarr          []string
+	SonarrOverrides config.SonarrOverrides
+	RadarrOverrides config.RadarrOverrides
+}
+
+// Router picks the target instances of a title. The first route whose
+// expression matches wins.
+type Router struct {
+	routes   []Route
+	defaults Targets
+}
+
+func NewRouter(cfg *config.Config) (*Router, error) {
+	r := &Router{}
+	for _, v := range cfg.Sonarr {
+		if v.Default {
+			r.defaults.Sonarr = append(r.defaults.Sonarr, v.Name)
+		}
+	}
+
+	for _, v := range cfg.Radarr {
+		if v.Default {
+			r.defaults.Radarr = append(r.defaults.Radarr, v.Name)
+		}
+	}
+
+	for i, v := range cfg.Routes {
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("route %v", i+1)
+		}
+
+		for _, s := range v.Sonarr {
+			if cfg.SonarrInstance(s) == nil {
+				return nil, fmt.Errorf("%v: unknown sonarr instance %q", name, s)
+			}
+		}
+
+		for _, m := range v.Radarr {
+			if cfg.RadarrInstance(m) == nil {
+				return nil, fmt.Errorf("%v: unknown radarr instance %q", name, m)
+			}
+		}
+
+		e, err := Compile(v.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+
+		route := Route{Name: name, Expr: e, Sonarr: v.Sonarr, Radarr: v.Radarr, SonarrOverrides: v.SonarrOverrides, RadarrOverrides: v.RadarrOverrides}
+		if len(route.Sonarr) == 0 && len(route.Radarr) == 0 {
+			route.Sonarr = r.defaults.Sonarr
+			route.Radarr = r.defaults.Radarr
+		}
+
+		r.routes = append(r.routes, route)
+	}
+
+	return r, nil
+}
+
+func (r *Router) Route(env map[string]any) (Targets, error) {
+	for _, v := range r.routes {
+		ok, err := v.Expr.Match(env)
+		if err != nil {
+			return Targets{}, fmt.Errorf("%v: %v", v.Name, err)
+		}
+
+		if ok {
+			return Targets{Route: v.Name, Sonarr: v.Sonarr, Radarr: v.Radarr, SonarrOverrides: v.SonarrOverrides, RadarrOverrides: v.RadarrOverrides}, nil
+		}
+	}
+
+	return r.defaults, nil
+}
+
+// Routes lists the routes with the instances they send titles to.
+func (r *Router) Routes() []Route {
+	return r.routes
+}
+
+func (t Targets) HasSonarr(name string) bool {
+	return contains(t.Sonarr, name)
+}
+
+func (t Targets) HasRadarr(name string) bool {
+	return contains(t.Radarr, name)
+}
+
+func contains(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/varoOP/shinkarr/internal/config"
+)
+
+type Action string
+
+const (
+	ActionInclude Action = "include"
+	ActionExclude Action = "exclude"
+)
+
+// Rule is a selection rule. Include rules only apply to titles on the
+// list unless AnyStatus is set.
+type Rule struct {
+	Name      string
+	Action    Action
+	Expr      *Expr
+	AnyStatus bool
+}
+
+// Set is an ordered list of selection rules. The first rule that matches a
+// title decides whether it is selected.
+type Set struct {
+	rules []Rule
+}
+
+// Decision is the outcome of evaluating a Set against a title. Rule is
+// empty when no rule matched.
+type Decision struct {
+	Selected bool
+	Rule     string
+	Reason   string
+}
+
+func NewSet(cfg []config.RuleConfig) (*Set, error) {
+	s := &Set{}
+	for i, v := range cfg {
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %v", i+1)
+		}
+
+		action := Action(v.Action)
+		if action != ActionInclude && action != ActionExclude {
+			return nil, fmt.Errorf("%v: action must be %q or %q, got %q", name, ActionInclude, ActionExclude, v.Action)
+		}
+
+		e, err := Compile(v.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+
+		if v.AnyStatus && action != ActionInclude {
+			return nil, fmt.Errorf("%v: AnyStatus only applies to include rules", name)
+		}
+
+		s.rules = append(s.rules, Rule{Name: name, Action: action, Expr: e, AnyStatus: v.AnyStatus})
+	}
+
+	return s, nil
+}
+
+// Evaluate runs the rules against env in order. onList tells whether the
+// title is on the list, like watching or plan to watch; include rules
+// without AnyStatus skip titles that aren't. When no rule matches, titles
+// on the list are selected.
+func (s *Set) Evaluate(env map[string]any, onList bool) (Decision, error) {
+	for _, r := range s.rules {
+		if r.Action == ActionInclude && !r.AnyStatus && !onList {
+			continue
+		}
+
+		ok, err := r.Expr.Match(env)
+		if err != nil {
+			return Decision{}, fmt.Errorf("%v: %v", r.Name, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if r.Action == ActionExclude {
+			return Decision{Rule: r.Name, Reason: fmt.Sprintf("excluded by rule %q", r.Name)}, nil
+		}
+
+		return Decision{Selected: true, Rule: r.Name}, nil
+	}
+
+	if !onList {
+		return Decision{Reason: "not on the watching or plan to watch list"}, nil
+	}
+
+	return Decision{Selected: true}, nil
+}
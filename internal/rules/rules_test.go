@@ -0,0 +1,44 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/varoOP/shinkarr/internal/config"
+)
+
+func TestEvaluate(t *testing.T) {
+	s, err := NewSet([]config.RuleConfig{
+		{Name: "popular", Action: "include", Expr: `num_list_users > 100000`},
+		{Name: "acclaimed", Action: "include", Expr: `mean >= 9`, AnyStatus: true},
+		{Name: "no-drama", Action: "exclude", Expr: `"Drama" in genres`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		env    map[string]any
+		onList bool
+		want   bool
+		rule   string
+	}{
+		{"include wins over a later exclude", map[string]any{"num_list_users": 200000.0, "mean": 7.0, "genres": []any{"Drama"}}, true, true, "popular"},
+		{"include ignores titles off the list", map[string]any{"num_list_users": 200000.0, "mean": 7.0, "genres": []any{}}, false, false, ""},
+		{"AnyStatus includes titles off the list", map[string]any{"num_list_users": 10.0, "mean": 9.5, "genres": []any{}}, false, true, "acclaimed"},
+		{"exclude applies to titles on the list", map[string]any{"num_list_users": 10.0, "mean": 7.0, "genres": []any{"Drama"}}, true, false, "no-drama"},
+		{"titles on the list are kept when nothing matches", map[string]any{"num_list_users": 10.0, "mean": 7.0, "genres": []any{}}, true, true, ""},
+	}
+
+	for _, tt := range tests {
+		d, err := s.Evaluate(tt.env, tt.onList)
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+
+		if d.Selected != tt.want || d.Rule != tt.rule {
+			t.Errorf("%v: got selected %v by %q, want %v by %q", tt.name, d.Selected, d.Rule, tt.want, tt.rule)
+		}
+	}
+}
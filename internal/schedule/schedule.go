@@ -0,0 +1,175 @@
+// Package schedule parses cron expressions of five fields: minute, hour,
+// day of month, month and day of week. Each field is *, a number, a range
+// like 1-5 or a list like 1,15, optionally stepped like */6 or 0-30/10.
+// As in cron, when both day fields are restricted a day matching either
+// one matches.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the day field is *.
+	domAny, dowAny bool
+}
+
+// bounds are the allowed values of each field.
+var bounds = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a cron expression like "0 */6 * * *".
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(bounds) {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %v", expr, len(fields))
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := parseField(f, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v %w", expr, bounds[i].name, err)
+		}
+
+		sets[i] = set
+	}
+
+	// 7 is Sunday as well as 0.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseField returns the values of a field as a bit set.
+func parseField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		r, s, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("has an invalid step %q", s)
+			}
+
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case r == "*":
+		case strings.Contains(r, "-"):
+			a, b, _ := strings.Cut(r, "-")
+			var err error
+			if lo, err = value(a, min, max); err != nil {
+				return 0, err
+			}
+
+			if hi, err = value(b, min, max); err != nil {
+				return 0, err
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("has an empty range %q", r)
+			}
+
+		default:
+			n, err := value(r, min, max)
+			if err != nil {
+				return 0, err
+			}
+
+			lo = n
+			if !stepped {
+				hi = n
+			}
+		}
+
+		for i := lo; i <= hi; i += step {
+			set |= 1 << i
+		}
+	}
+
+	return set, nil
+}
+
+func value(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("has an invalid value %q", s)
+	}
+
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %v is not between %v and %v", n, min, max)
+	}
+
+	return n, nil
+}
+
+// Next returns the first time after t the schedule matches, in the location
+// of t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every combination repeats within a few years; give up after that
+	// rather than loop forever on dates like February 30.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,138 @@
+package season
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// startMonths are the months the MAL seasons start in.
+var startMonths = map[string]time.Month{
+	"winter": time.January,
+	"spring": time.April,
+	"summer": time.July,
+	"fall":   time.October,
+}
+
+// Start returns the first day of season in year.
+func Start(season string, year int) time.Time {
+	return time.Date(year, startMonths[season], 1, 0, 0, 0, 0, time.UTC)
+}
+
+// End returns the first day after season in year.
+func End(season string, year int) time.Time {
+	return Start(season, year).AddDate(0, 3, 0)
+}
+
+// Key identifies a season, like spring-2024.
+func Key(season string, year int) string {
+	return fmt.Sprintf("%v-%v", season, year)
+}
+
+// ParseKey splits a key made by Key into season and year. The season name
+// is matched regardless of case.
+func ParseKey(key string) (string, int, error) {
+	season, y, ok := strings.Cut(strings.ToLower(key), "-")
+	if _, known := startMonths[season]; !ok || !known {
+		return "", 0, fmt.Errorf("invalid season %q", key)
+	}
+
+	year, err := strconv.Atoi(y)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid season %q", key)
+	}
+
+	return season, year, nil
+}
+
+// Of returns the season t falls in.
+func Of(t time.Time) (string, int) {
+	for _, s := range []string{"fall", "summer", "spring", "winter"} {
+		if t.Month() >= startMonths[s] {
+			return s, t.Year()
+		}
+	}
+
+	return "winter", t.Year()
+}
+
+// Valid reports whether s is the name of a MAL season.
+func Valid(s string) bool {
+	_, ok := startMonths[s]
+	return ok
+}
+
+// Next returns the season after season in year.
+func Next(season string, year int) (string, int) {
+	return Of(End(season, year))
+}
+
+// Previous returns the season before season in year.
+func Previous(season string, year int) (string, int) {
+	return Of(Start(season, year).AddDate(0, -1, 0))
+}
+
+// Resolve turns the name given on the command line into a season and year
+// relative to t. name is current, next, previous or a season name, in any
+// case. Without year a season name means the season of this year, except
+// that winter in December means the winter about to start.
+func Resolve(name string, year int, t time.Time) (string, int, error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "current", "next", "previous":
+		if year != 0 {
+			return "", 0, fmt.Errorf("a year can't be given with season %v", name)
+		}
+
+		s, y := Of(t)
+		switch name {
+		case "next":
+			s, y = Next(s, y)
+		case "previous":
+			s, y = Previous(s, y)
+		}
+
+		return s, y, nil
+	}
+
+	if !Valid(name) {
+		return "", 0, fmt.Errorf("unknown season %q, must be current, next, previous, winter, spring, summer or fall", name)
+	}
+
+	if year == 0 {
+		year = t.Year()
+		if name == "winter" && t.Month() == time.December {
+			year++
+		}
+	}
+
+	return name, year, nil
+}
+
+// Parse reads a season given either as a key like spring-2024 or as a name
+// Resolve understands.
+func Parse(s string, t time.Time) (string, int, error) {
+	if strings.Contains(s, "-") {
+		return ParseKey(s)
+	}
+
+	return Resolve(s, 0, t)
+}
+
+// Range returns the keys of the seasons from the first to the last, both
+// included.
+func Range(fromSeason string, fromYear int, toSeason string, toYear int) ([]string, error) {
+	if Start(fromSeason, fromYear).After(Start(toSeason, toYear)) {
+		return nil, fmt.Errorf("%v is after %v", Key(fromSeason, fromYear), Key(toSeason, toYear))
+	}
+
+	keys := []string{}
+	s, y := fromSeason, fromYear
+	for !Start(s, y).After(Start(toSeason, toYear)) {
+		keys = append(keys, Key(s, y))
+		s, y = Next(s, y)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,215 @@
+package sonarr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Episode struct {
+	AbsoluteEpisodeNumber int32     `json:"absoluteEpisodeNumber,omitempty"`
+	AirDateUtc            time.Time `json:"airDateUtc"`
+	EpisodeFileId         int32     `json:"episodeFileId,omitempty"`
+	EpisodeNumber         int32     `json:"episodeNumber"`
+	HasFile               bool      `json:"hasFile,omitempty"`
+	Id                    int32     `json:"id,omitempty"`
+	Monitored             bool      `json:"monitored"`
+	SeasonNumber          int32     `json:"seasonNumber"`
+	SeriesId              int32     `json:"seriesId,omitempty"`
+	Title                 string    `json:"title"`
+	TvdbId                int32     `json:"tvdbId,omitempty"`
+}
+
+// ErrSeriesNotFound means the series isn't in Sonarr.
+var ErrSeriesNotFound = errors.New("series not found in Sonarr")
+
+type EpisodesMonitoredResource struct {
+	EpisodeIds []int32 `json:"episodeIds"`
+	Monitored  bool    `json:"monitored"`
+}
+
+// SeasonStart marks where a MAL entry begins on TVDB: episode Start of
+// season SeasonNumber is episode 1 on MAL. End, if set, is the last episode
+// of the season that belongs to the entry.
+type SeasonStart struct {
+	SeasonNumber int32
+	Start        int32
+	End          int32
+}
+
+func (c *Client) GetEpisodes(seriesId int32) ([]Episode, error) {
+	e := []Episode{}
+	u := c.config.Url.JoinPath("/api/v3/episode")
+	params := u.Query()
+	params.Add("seriesId", fmt.Sprintf("%v", seriesId))
+	u.RawQuery = params.Encode()
+
+	data, err := c.SendGetRequest(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (c *Client) MonitorEpisodes(ids []int32, monitored bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(EpisodesMonitoredResource{
+		EpisodeIds: ids,
+		Monitored:  monitored,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.SendPutRequest(c.config.Url.JoinPath("/api/v3/episode/monitor").String(), body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MonitorUnwatched unmonitors the first watched episodes of the MAL entry
+// laid out by seasons and monitors the ones after them. It returns the
+// number of episodes that were unmonitored, or -1 if Sonarr has no episodes
+// for the series yet.
+func (c *Client) MonitorUnwatched(tvdbid int32, seasons []SeasonStart, watched int) (int, error) {
+	ss, err := c.GetSeries(tvdbid)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ss) == 0 {
+		return 0, fmt.Errorf("series with tvdbid %v not found in Sonarr", tvdbid)
+	}
+
+	episodes, err := c.GetEpisodes(ss[0].Id)
+	if err != nil {
+		return 0, err
+	}
+
+	ordered := mappedEpisodes(episodes, seasons)
+	if len(ordered) == 0 {
+		return -1, nil
+	}
+
+	if watched > len(ordered) {
+		watched = len(ordered)
+	}
+
+	unmonitor := []int32{}
+	for _, e := range ordered[:watched] {
+		if e.Monitored {
+			unmonitor = append(unmonitor, e.Id)
+		}
+	}
+
+	monitor := []int32{}
+	for _, e := range ordered[watched:] {
+		if !e.Monitored {
+			monitor = append(monitor, e.Id)
+		}
+	}
+
+	if err := c.MonitorEpisodes(unmonitor, false); err != nil {
+		return 0, err
+	}
+
+	if err := c.MonitorEpisodes(monitor, true); err != nil {
+		return 0, err
+	}
+
+	return len(unmonitor), nil
+}
+
+// mappedEpisodes returns the episodes of the MAL entry laid out by seasons,
+// in order.
+func mappedEpisodes(episodes []Episode, seasons []SeasonStart) []Episode {
+	ordered := []Episode{}
+	for _, season := range seasons {
+		start := season.Start
+		if start <= 0 {
+			start = 1
+		}
+
+		inSeason := []Episode{}
+		for _, e := range episodes {
+			if e.SeasonNumber != season.SeasonNumber || e.EpisodeNumber < start {
+				continue
+			}
+
+			if season.End > 0 && e.EpisodeNumber > season.End {
+				continue
+			}
+
+			inSeason = append(inSeason, e)
+		}
+
+		sort.Slice(inSeason, func(i, j int) bool {
+			return inSeason[i].EpisodeNumber < inSeason[j].EpisodeNumber
+		})
+
+		ordered = append(ordered, inSeason...)
+	}
+
+	return ordered
+}
+
+// MonitorSpecials monitors count season 0 episodes of the series with
+// tvdbid, starting at episode start, and leaves its other episodes alone.
+// The series must already be in Sonarr, ErrSeriesNotFound is returned if it
+// isn't. It returns the number of episodes that were newly monitored, or -1
+// if Sonarr has none of the episodes yet.
+func (c *Client) MonitorSpecials(tvdbid int32, start, count int32) (int, error) {
+	ss, err := c.GetSeries(tvdbid)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ss) == 0 {
+		return 0, fmt.Errorf("parent series with tvdbid %v: %w", tvdbid, ErrSeriesNotFound)
+	}
+
+	episodes, err := c.GetEpisodes(ss[0].Id)
+	if err != nil {
+		return 0, err
+	}
+
+	if start <= 0 {
+		start = 1
+	}
+
+	found := 0
+	monitor := []int32{}
+	for _, e := range episodes {
+		if e.SeasonNumber != 0 || e.EpisodeNumber < start || e.EpisodeNumber >= start+count {
+			continue
+		}
+
+		found++
+		if !e.Monitored {
+			monitor = append(monitor, e.Id)
+		}
+	}
+
+	if found == 0 {
+		return -1, nil
+	}
+
+	if err := c.MonitorEpisodes(monitor, true); err != nil {
+		return 0, err
+	}
+
+	return len(monitor), nil
+}
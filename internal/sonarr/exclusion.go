@@ -0,0 +1,62 @@
+package sonarr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ImportListExclusion is a series Sonarr won't add from import lists.
+type ImportListExclusion struct {
+	Id     int32  `json:"id,omitempty"`
+	TvdbId int32  `json:"tvdbId"`
+	Title  string `json:"title"`
+}
+
+// GetExclusions returns the tvdb ids of the import list exclusions.
+func (c *Client) GetExclusions() (map[int32]bool, error) {
+	e := []ImportListExclusion{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/importlistexclusion").String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	ids := map[int32]bool{}
+	for _, v := range e {
+		ids[v.TvdbId] = true
+	}
+
+	return ids, nil
+}
+
+// AddExclusion adds the series to the import list exclusions, unless it is
+// already there.
+func (c *Client) AddExclusion(tvdbid int32, title string) error {
+	excluded, err := c.GetExclusions()
+	if err != nil {
+		return err
+	}
+
+	if excluded[tvdbid] {
+		return nil
+	}
+
+	p, err := json.Marshal(ImportListExclusion{TvdbId: tvdbid, Title: title})
+	if err != nil {
+		return err
+	}
+
+	_, se, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/importlistexclusion").String(), p)
+	if err != nil {
+		return err
+	}
+
+	if se != nil {
+		return fmt.Errorf("%v: %v", se.PropertyName, se.ErrorMessage)
+	}
+
+	return nil
+}
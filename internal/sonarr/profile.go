@@ -0,0 +1,101 @@
+package sonarr
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type QualityProfile struct {
+	Id   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+type RootFolder struct {
+	Id         int32  `json:"id"`
+	Path       string `json:"path"`
+	Accessible bool   `json:"accessible"`
+	FreeSpace  int64  `json:"freeSpace"`
+}
+
+func (c *Client) GetQualityProfiles() ([]QualityProfile, error) {
+	p := []QualityProfile{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/qualityprofile").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (c *Client) GetRootFolders() ([]RootFolder, error) {
+	r := []RootFolder{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/rootfolder").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type SystemStatus struct {
+	AppName string `json:"appName"`
+	Version string `json:"version"`
+}
+
+// MajorVersion returns the major version number, or 0 if it can't be parsed.
+func (s *SystemStatus) MajorVersion() int {
+	major, _, _ := strings.Cut(s.Version, ".")
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+
+	return v
+}
+
+func (c *Client) GetSystemStatus() (*SystemStatus, error) {
+	s := &SystemStatus{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/system/status").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+type LanguageProfile struct {
+	Id   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetLanguageProfiles lists the language profiles. Only Sonarr v3 has them.
+func (c *Client) GetLanguageProfiles() ([]LanguageProfile, error) {
+	l := []LanguageProfile{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/languageprofile").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &l)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/varoOP/shinkarr/internal/config"
@@ -35,6 +36,30 @@ const (
 	MonitorTypesUnmonitorSpecials MonitorTypes = "unmonitorSpecials"
 )
 
+// MonitorTypeValues are the monitor types a series can be added with.
+var MonitorTypeValues = []MonitorTypes{
+	MonitorTypesAll,
+	MonitorTypesExisting,
+	MonitorTypesFirstSeason,
+	MonitorTypesFuture,
+	MonitorTypesLatestSeason,
+	MonitorTypesMissing,
+	MonitorTypesMonitorSpecials,
+	MonitorTypesNone,
+	MonitorTypesPilot,
+	MonitorTypesUnmonitorSpecials,
+}
+
+func ValidMonitorType(s string) bool {
+	for _, v := range MonitorTypeValues {
+		if string(v) == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 type AlternateTitleResource struct {
 	Comment           string `json:"comment"`
 	SceneOrigin       string `json:"sceneOrigin"`
@@ -97,6 +122,18 @@ const (
 	Standard SeriesTypes = "standard"
 )
 
+var SeriesTypeValues = []SeriesTypes{Anime, Daily, Standard}
+
+func ValidSeriesType(s string) bool {
+	for _, v := range SeriesTypeValues {
+		if string(v) == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 type SeriesStatisticsResource struct {
 	EpisodeCount      int32    `json:"episodeCount,omitempty"`
 	EpisodeFileCount  int32    `json:"episodeFileCount,omitempty"`
@@ -148,6 +185,7 @@ type Series struct {
 	Id                int32                    `json:"id,omitempty"`
 	Images            []MediaCover             `json:"images"`
 	ImdbId            string                   `json:"imdbId"`
+	LanguageProfileId int32                    `json:"languageProfileId,omitempty"`
 	Monitored         bool                     `json:"monitored,omitempty"`
 	Network           string                   `json:"network"`
 	NextAiring        time.Time                `json:"nextAiring"`
@@ -177,6 +215,15 @@ type Series struct {
 	Year              int32                    `json:"year,omitempty"`
 }
 
+type Command struct {
+	Id       int32  `json:"id,omitempty"`
+	Name     string `json:"name"`
+	SeriesId int32  `json:"seriesId,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+const CommandSeriesSearch = "SeriesSearch"
+
 type Tag struct {
 	Id    int32  `json:"id"`
 	Label string `json:"label"`
@@ -184,34 +231,52 @@ type Tag struct {
 
 type Client struct {
 	client *http.Client
-	config *config.Config
+	config *config.SonarrConfig
 }
 
-func NewClient(cfg *config.Config) *Client {
-	c := &http.Client{
-		Transport: &config.ApiKeyTransport{ApiKey: cfg.Sonarr.ApiKey},
-	}
-
+func NewClient(cfg *config.SonarrConfig) *Client {
 	return &Client{
 		config: cfg,
-		client: c,
+		client: cfg.Client(cfg.ApiKey),
+	}
+}
+
+// SeriesOptions are the settings a series is added with. NewSeriesOptions
+// fills them in from the instance config.
+type SeriesOptions struct {
+	QualityProfileId int32
+	RootFolderPath   string
+	SeriesType       SeriesTypes
+	SeasonFolder     bool
+	Search           bool
+}
+
+func (c *Client) NewSeriesOptions() SeriesOptions {
+	return SeriesOptions{
+		QualityProfileId: c.config.QualityProfileID,
+		RootFolderPath:   c.config.RootFolderPath,
+		SeriesType:       SeriesTypes(c.config.SeriesType),
+		SeasonFolder:     c.config.SeasonFolder,
 	}
 }
 
-func (c *Client) AddSeries(title string, tvdbid int32, tags []int32) error {
+// AddSeries adds the series and reports whether it was created; a series
+// that was already added only gets the missing tags.
+func (c *Client) AddSeries(title string, tvdbid int32, tags []int32, opts SeriesOptions) (bool, error) {
 	s := Series{
-		Title:            title,
-		QualityProfileId: c.config.Sonarr.QualityProfileID,
-		SeasonFolder:     c.config.Sonarr.SeasonFolder,
-		Monitored:        c.config.Sonarr.Monitored,
-		TvdbId:           tvdbid,
-		SeriesType:       SeriesTypes("anime"),
-		RootFolderPath:   c.config.Sonarr.RootFolderPath,
+		Title:             title,
+		QualityProfileId:  opts.QualityProfileId,
+		LanguageProfileId: c.config.LanguageProfileID,
+		SeasonFolder:      opts.SeasonFolder,
+		Monitored:         c.config.Monitored,
+		TvdbId:            tvdbid,
+		SeriesType:        opts.SeriesType,
+		RootFolderPath:    opts.RootFolderPath,
 		AddOptions: AddSeriesOptions{
 			IgnoreEpisodesWithFiles:      false,
 			IgnoreEpisodesWithoutFiles:   false,
-			Monitor:                      MonitorTypes(c.config.Sonarr.MonitorType),
-			SearchForMissingEpisodes:     false,
+			Monitor:                      MonitorTypes(c.config.MonitorType),
+			SearchForMissingEpisodes:     opts.Search,
 			SearchForCutoffUnmetEpisodes: false,
 		},
 		Tags: tags,
@@ -219,40 +284,47 @@ func (c *Client) AddSeries(title string, tvdbid int32, tags []int32) error {
 
 	p, err := json.Marshal(s)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, se, err := c.SendPostRequest(c.config.Sonarr.Url.JoinPath("/api/v3/series").String(), p)
+	_, se, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/series").String(), p)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if se != nil {
 		if se.ErrorMessage == string(SonarrErrorMessageSeriesAlreadyAdded) {
 			ss, err := c.GetSeries(s.TvdbId)
 			if err != nil {
-				return err
+				return false, err
 			}
 
-			if ss[0].HaveTag(tags[0]) {
-				return nil
+			if ss[0].HaveTags(tags) {
+				return false, nil
 			} else {
-				err = c.PutSeries(s.Id, ss, tags)
+				err = c.PutSeries(ss[0].Id, ss, tags)
 				if err != nil {
-					return err
+					return false, err
 				}
 
-				return nil
+				return false, nil
 			}
 		}
+
+		return false, fmt.Errorf("%v: %v", se.PropertyName, se.ErrorMessage)
 	}
 
-	return nil
+	return true, nil
 }
 
 func (c *Client) PutSeries(id int32, s []Series, tags []int32) error {
-	u := c.config.Sonarr.Url.JoinPath(fmt.Sprintf("/api/v3/series/%v", id))
-	s[0].Tags = append(s[0].Tags, tags[0])
+	u := c.config.Url.JoinPath(fmt.Sprintf("/api/v3/series/%v", id))
+	for _, t := range tags {
+		if !s[0].HaveTag(t) {
+			s[0].Tags = append(s[0].Tags, t)
+		}
+	}
+
 	body, err := json.MarshalIndent(s[0], "", "  ")
 	if err != nil {
 		return err
@@ -266,6 +338,114 @@ func (c *Client) PutSeries(id int32, s []Series, tags []int32) error {
 	return nil
 }
 
+func (c *Client) UpdateSeries(s *Series, moveFiles bool) error {
+	u := c.config.Url.JoinPath(fmt.Sprintf("/api/v3/series/%v", s.Id))
+	if moveFiles {
+		params := u.Query()
+		params.Add("moveFiles", "true")
+		u.RawQuery = params.Encode()
+	}
+
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.SendPutRequest(u.String(), body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyLifecycle brings the seasons of the series with the given tvdbid
+// that the MAL entry maps to in line with rule. Monitored only applies to
+// the episodes of those seasons, so the rest of the series, shared with
+// other MAL entries, is left alone. Unmonitoring leaves aired episodes as
+// they are; monitoring also picks up aired episodes without a file, like
+// those that aired while the title was on hold, and turns the series itself
+// on. QualityProfileID and RootFolderPath apply to
+// the whole series and are only changed with seriesWide. It reports whether
+// the series exists in Sonarr and whether it was changed.
+func (c *Client) ApplyLifecycle(tvdbid int32, seasons []SeasonStart, rule config.LifecycleRule, seriesWide bool) (bool, bool, error) {
+	ss, err := c.GetSeries(tvdbid)
+	if err != nil {
+		return false, false, err
+	}
+
+	if len(ss) == 0 {
+		return false, false, nil
+	}
+
+	s := &ss[0]
+	changed := false
+	seriesChanged := false
+	if rule.Monitored != nil {
+		if *rule.Monitored && !s.Monitored {
+			s.Monitored = true
+			seriesChanged = true
+		}
+
+		episodes, err := c.GetEpisodes(s.Id)
+		if err != nil {
+			return true, false, err
+		}
+
+		now := time.Now()
+		ids := []int32{}
+		for _, e := range mappedEpisodes(episodes, seasons) {
+			aired := !e.AirDateUtc.IsZero() && e.AirDateUtc.Before(now)
+			if aired && (!*rule.Monitored || e.HasFile) {
+				continue
+			}
+
+			if e.Monitored != *rule.Monitored {
+				ids = append(ids, e.Id)
+			}
+		}
+
+		if err := c.MonitorEpisodes(ids, *rule.Monitored); err != nil {
+			return true, false, err
+		}
+
+		changed = len(ids) > 0
+	}
+
+	if seriesWide && rule.QualityProfileID > 0 && s.QualityProfileId != rule.QualityProfileID {
+		s.QualityProfileId = rule.QualityProfileID
+		seriesChanged = true
+	}
+
+	moveFiles := false
+	if seriesWide && rule.RootFolderPath != "" && s.RootFolderPath != rule.RootFolderPath {
+		s.RootFolderPath = rule.RootFolderPath
+		s.Path = path.Join(rule.RootFolderPath, path.Base(s.Path))
+		moveFiles = rule.MoveFiles
+		seriesChanged = true
+	}
+
+	if !seriesChanged {
+		return true, changed, nil
+	}
+
+	if err := c.UpdateSeries(s, moveFiles); err != nil {
+		return true, changed, err
+	}
+
+	return true, true, nil
+}
+
+func (s *Series) HaveTags(ids []int32) bool {
+	for _, id := range ids {
+		if !s.HaveTag(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *Series) HaveTag(id int32) bool {
 	for _, v := range s.Tags {
 		if v == id {
@@ -278,7 +458,7 @@ func (s *Series) HaveTag(id int32) bool {
 
 func (c *Client) GetSeries(tvdbid int32) ([]Series, error) {
 	s := []Series{}
-	u := c.config.Sonarr.Url.JoinPath("/api/v3/series")
+	u := c.config.Url.JoinPath("/api/v3/series")
 	params := u.Query()
 	params.Add("tvdbId", fmt.Sprintf("%v", tvdbid))
 	u.RawQuery = params.Encode()
@@ -296,6 +476,43 @@ func (c *Client) GetSeries(tvdbid int32) ([]Series, error) {
 	return s, nil
 }
 
+func (c *Client) GetAllSeries() ([]Series, error) {
+	s := []Series{}
+	data, err := c.SendGetRequest(c.config.Url.JoinPath("/api/v3/series").String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SearchSeries queues a search for all missing episodes of the series.
+func (c *Client) SearchSeries(id int32) error {
+	p, err := json.Marshal(Command{
+		Name:     CommandSeriesSearch,
+		SeriesId: id,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, se, err := c.SendPostRequest(c.config.Url.JoinPath("/api/v3/command").String(), p)
+	if err != nil {
+		return err
+	}
+
+	if se != nil {
+		return fmt.Errorf("%v", se.ErrorMessage)
+	}
+
+	return nil
+}
+
 func (c *Client) AddTag(label string) (int32, error) {
 	t := Tag{
 		Label: label,
@@ -306,7 +523,7 @@ func (c *Client) AddTag(label string) (int32, error) {
 		return -1, err
 	}
 
-	url := c.config.Sonarr.Url.JoinPath("/api/v3/tag").String()
+	url := c.config.Url.JoinPath("/api/v3/tag").String()
 	resp, _, err := c.SendPostRequest(url, p)
 	if err != nil {
 		return -1, err
@@ -320,15 +537,39 @@ func (c *Client) AddTag(label string) (int32, error) {
 	return t.Id, nil
 }
 
-func (c *Client) TagExists(label string) (bool, int32, error) {
+func (c *Client) GetTags() ([]Tag, error) {
 	var tags []Tag
-	url := c.config.Sonarr.Url.JoinPath("/api/v3/tag").String()
+	url := c.config.Url.JoinPath("/api/v3/tag").String()
 	data, err := c.SendGetRequest(url)
 	if err != nil {
-		return false, -1, err
+		return nil, err
 	}
 
 	err = json.Unmarshal(data, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetTagMap returns the ids of all tags keyed by label.
+func (c *Client) GetTagMap() (map[string]int32, error) {
+	tags, err := c.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]int32{}
+	for _, v := range tags {
+		m[v.Label] = v.Id
+	}
+
+	return m, nil
+}
+
+func (c *Client) TagExists(label string) (bool, int32, error) {
+	tags, err := c.GetTags()
 	if err != nil {
 		return false, -1, err
 	}
@@ -379,6 +620,10 @@ func (c *Client) SendGetRequest(url string) ([]byte, error) {
 		return nil, err
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("sonarr rejected the API key (401 Unauthorized)")
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("responseGet from Sonarr:\n%v", string(rb))
 	}
@@ -0,0 +1,231 @@
+package state
+
+import (
+	"database/sql"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+// DB is the database shinkarr keeps its own state in, next to its config.
+type DB struct {
+	Handler *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS autobrr_filter (
+	season    TEXT PRIMARY KEY,
+	filter_id INTEGER NOT NULL,
+	retired   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS season_anime (
+	season TEXT NOT NULL,
+	mal_id INTEGER NOT NULL,
+	PRIMARY KEY (season, mal_id)
+);
+
+CREATE TABLE IF NOT EXISTS added (
+	instance    TEXT NOT NULL,
+	mal_id      INTEGER NOT NULL,
+	external_id INTEGER NOT NULL,
+	title       TEXT NOT NULL,
+	list_status TEXT NOT NULL,
+	added       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	deleted     TIMESTAMP,
+	PRIMARY KEY (instance, mal_id)
+);
+
+CREATE TABLE IF NOT EXISTS exclusion (
+	mal_id  INTEGER PRIMARY KEY,
+	title   TEXT NOT NULL,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+func NewDB(DSN string) *DB {
+	db := &DB{}
+	var err error
+	db.Handler, err = sql.Open("sqlite", DSN)
+	check(err)
+	_, err = db.Handler.Exec(`PRAGMA journal_mode = wal;`)
+	check(err)
+	_, err = db.Handler.Exec(schema)
+	check(err)
+	return db
+}
+
+// SeasonFilter is the autobrr filter created for a season.
+type SeasonFilter struct {
+	Season   string
+	FilterID int32
+	Retired  bool
+}
+
+func (db *DB) SeasonFilters() ([]SeasonFilter, error) {
+	rows, err := db.Handler.Query("SELECT season, filter_id, retired FROM autobrr_filter ORDER BY season")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	filters := []SeasonFilter{}
+	for rows.Next() {
+		f := SeasonFilter{}
+		if err := rows.Scan(&f.Season, &f.FilterID, &f.Retired); err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	return filters, rows.Err()
+}
+
+// SeasonFilter returns the filter of season, or nil if there is none.
+func (db *DB) SeasonFilter(season string) (*SeasonFilter, error) {
+	f := &SeasonFilter{}
+	err := db.Handler.QueryRow("SELECT season, filter_id, retired FROM autobrr_filter WHERE season=?", season).Scan(&f.Season, &f.FilterID, &f.Retired)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (db *DB) SaveSeasonFilter(season string, filterID int32) error {
+	_, err := db.Handler.Exec("INSERT OR REPLACE INTO autobrr_filter (season, filter_id, retired) VALUES (?, ?, 0)", season, filterID)
+	return err
+}
+
+func (db *DB) RetireSeasonFilter(season string) error {
+	_, err := db.Handler.Exec("UPDATE autobrr_filter SET retired=1 WHERE season=?", season)
+	return err
+}
+
+// AddSeasonAnime records malids as titles of season.
+func (db *DB) AddSeasonAnime(season string, malids []int32) error {
+	tx, err := db.Handler.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+	for _, id := range malids {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO season_anime (season, mal_id) VALUES (?, ?)", season, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) SeasonAnime(season string) ([]int32, error) {
+	rows, err := db.Handler.Query("SELECT mal_id FROM season_anime WHERE season=?", season)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	ids := []int32{}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Added is a title shinkarr added to an instance. ExternalID is the tvdb id
+// for Sonarr and the tmdb id for Radarr. A title deleted from the instance
+// since is kept as a tombstone with Deleted set.
+type Added struct {
+	MalID      int32
+	ExternalID int32
+	Title      string
+	ListStatus string
+	Deleted    bool
+}
+
+// RecordAdded records that the title was added to instance, the config path
+// of the instance like sonarr.4k, clearing any tombstone.
+func (db *DB) RecordAdded(instance string, malid, externalID int32, title, listStatus string) error {
+	_, err := db.Handler.Exec(`INSERT INTO added (instance, mal_id, external_id, title, list_status) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (instance, mal_id) DO UPDATE SET external_id=excluded.external_id, title=excluded.title, list_status=excluded.list_status, deleted=NULL`,
+		instance, malid, externalID, title, listStatus)
+	return err
+}
+
+// History returns the titles added to instance keyed by mal id.
+func (db *DB) History(instance string) (map[int32]Added, error) {
+	rows, err := db.Handler.Query("SELECT mal_id, external_id, title, list_status, deleted IS NOT NULL FROM added WHERE instance=?", instance)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	history := map[int32]Added{}
+	for rows.Next() {
+		a := Added{}
+		if err := rows.Scan(&a.MalID, &a.ExternalID, &a.Title, &a.ListStatus, &a.Deleted); err != nil {
+			return nil, err
+		}
+
+		history[a.MalID] = a
+	}
+
+	return history, rows.Err()
+}
+
+// MarkDeleted turns the title added to instance into a tombstone.
+func (db *DB) MarkDeleted(instance string, malid int32) error {
+	_, err := db.Handler.Exec("UPDATE added SET deleted=CURRENT_TIMESTAMP WHERE instance=? AND mal_id=?", instance, malid)
+	return err
+}
+
+// SetListStatus updates the MAL list status recorded for the title.
+func (db *DB) SetListStatus(instance string, malid int32, listStatus string) error {
+	_, err := db.Handler.Exec("UPDATE added SET list_status=? WHERE instance=? AND mal_id=?", listStatus, instance, malid)
+	return err
+}
+
+// AddExclusion records that the title must never be added.
+func (db *DB) AddExclusion(malid int32, title string) error {
+	_, err := db.Handler.Exec("INSERT OR REPLACE INTO exclusion (mal_id, title) VALUES (?, ?)", malid, title)
+	return err
+}
+
+// Exclusions returns the mal ids of the excluded titles.
+func (db *DB) Exclusions() (map[int32]bool, error) {
+	rows, err := db.Handler.Query("SELECT mal_id FROM exclusion")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	ids := map[int32]bool{}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+func check(err error) {
+	if err != nil {
+		log.Fatalf("state database error: %v", err)
+	}
+}